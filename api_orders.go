@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"orders-service/model"
+)
+
+// OrderList — страница списка заказов
+type OrderList struct {
+	Orders []*Order `json:"orders"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+// IngestResult — результат приема заказа через HTTP
+type IngestResult struct {
+	OrderUID string  `json:"order_uid"`
+	Outcome  Outcome `json:"outcome"`
+}
+
+// handleListOrders отдает заказы из кэша, новые первыми, с фильтрами
+// customer_id и delivery_service и постраничным выводом (limit, offset)
+func (s *Server) handleListOrders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, err := queryInt(q.Get("limit"), 50)
+		if err != nil || limit < 1 || limit > 500 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "limit: 1..500")
+			return
+		}
+		offset, err := queryInt(q.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "offset: >= 0")
+			return
+		}
+
+		customerID, deliveryService := q.Get("customer_id"), q.Get("delivery_service")
+		var orders []*Order
+		for _, order := range s.cache.GetAll() {
+			if customerID != "" && order.CustomerID != customerID {
+				continue
+			}
+			if deliveryService != "" && order.DeliveryService != deliveryService {
+				continue
+			}
+			orders = append(orders, order)
+		}
+		sort.Slice(orders, func(i, j int) bool {
+			if !orders[i].DateCreated.Equal(orders[j].DateCreated) {
+				return orders[i].DateCreated.After(orders[j].DateCreated)
+			}
+			return orders[i].OrderUID < orders[j].OrderUID
+		})
+
+		list := OrderList{Orders: []*Order{}, Total: len(orders), Limit: limit, Offset: offset}
+		if offset < len(orders) {
+			list.Orders = s.presentAll(r, orders[offset:min(offset+limit, len(orders))])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// handleIngestOrder принимает заказ через HTTP и прогоняет его через тот же
+// конвейер, что и сообщения из NATS: тело может быть JSON-заказом, конвертом
+// или protobuf-заказом
+func (s *Server) handleIngestOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, err.Error())
+			return
+		case err != nil:
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		source := fmt.Sprintf("http:%s", r.RemoteAddr)
+		outcome, order, err := s.processor.Process(data, source, false)
+		logOutcome(outcome, order, err, data)
+		switch {
+		case errors.Is(err, model.ErrInvalidOrder):
+			writeProblem(w, r, http.StatusUnprocessableEntity, CodeInvalidOrder, err.Error())
+			return
+		case err != nil:
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(IngestResult{OrderUID: order.OrderUID, Outcome: outcome})
+	}
+}
+
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
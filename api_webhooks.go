@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// handleCreateWebhook регистрирует вебхук. Ключ подписи возвращается только
+// в этом ответе.
+func (s *Server) handleCreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.webhooksEnabled(w, r) {
+			return
+		}
+		var req WebhookRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		hook, err := s.webhooks.Create(r.Context(), req, principalFrom(r.Context()).Subject)
+		if !webhookError(w, r, err) {
+			return
+		}
+		log.Printf("Зарегистрирован вебхук %d: %s", hook.ID, hook.URL)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/admin/webhooks/"+strconv.FormatInt(hook.ID, 10))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hook)
+	}
+}
+
+// handleListWebhooks возвращает зарегистрированные вебхуки
+func (s *Server) handleListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.webhooksEnabled(w, r) {
+			return
+		}
+		hooks, err := s.webhooks.List(r.Context())
+		if !webhookError(w, r, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"webhooks": hooks})
+	}
+}
+
+// handleDeleteWebhook удаляет вебхук вместе с журналом доставок
+func (s *Server) handleDeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.webhooksEnabled(w, r) {
+			return
+		}
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		if !webhookError(w, r, s.webhooks.Delete(r.Context(), id)) {
+			return
+		}
+		log.Printf("Удален вебхук %d", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleWebhookDeliveries возвращает журнал доставок вебхука, новые первыми
+func (s *Server) handleWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.webhooksEnabled(w, r) {
+			return
+		}
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		limit, err := queryInt(q.Get("limit"), 50)
+		if err != nil || limit < 1 || limit > 500 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "limit: 1..500")
+			return
+		}
+		offset, err := queryInt(q.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "offset: >= 0")
+			return
+		}
+
+		list, err := s.webhooks.Deliveries(r.Context(), id, q.Get("status"), limit, offset)
+		if !webhookError(w, r, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// handleRetryWebhookDelivery возвращает доставку в очередь с немедленной попыткой
+func (s *Server) handleRetryWebhookDelivery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.webhooksEnabled(w, r) {
+			return
+		}
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		deliveryID, ok := pathID(w, r, "delivery")
+		if !ok {
+			return
+		}
+		if !webhookError(w, r, s.webhooks.Retry(r.Context(), id, deliveryID)) {
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Server) webhooksEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.webhooks == nil {
+		writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "вебхуки не настроены")
+		return false
+	}
+	return true
+}
+
+// webhookError отвечает ошибкой, если err не nil, и возвращает true, если
+// ошибки не было
+func webhookError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrInvalidWebhook):
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, ErrWebhookNotFound):
+		writeProblem(w, r, http.StatusNotFound, CodeWebhookNotFound, err.Error())
+	default:
+		log.Printf("Ошибка работы с вебхуками: %v", err)
+		writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
+	}
+	return false
+}
+
+// pathID разбирает числовой параметр пути name; при ошибке отвечает 400
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil || id < 1 {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, name+": положительное целое число")
+		return 0, false
+	}
+	return id, true
+}
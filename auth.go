@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Роли пользователей API. Каждая следующая роль включает права предыдущей.
+const (
+	RoleViewer  = "viewer"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Permission — право, которое требует маршрут
+type Permission int
+
+const (
+	// PermRead — чтение заказов
+	PermRead Permission = iota
+	// PermPII — просмотр персональных данных покупателей
+	PermPII
+	// PermAdmin — прием заказов и административные операции
+	PermAdmin
+)
+
+// rolePermissions — права каждой роли
+var rolePermissions = map[string][]Permission{
+	RoleViewer:  {PermRead},
+	RoleSupport: {PermRead, PermPII},
+	RoleAdmin:   {PermRead, PermPII, PermAdmin},
+}
+
+var (
+	ErrUnauthenticated = errors.New("требуется аутентификация")
+	ErrForbidden       = errors.New("недостаточно прав")
+)
+
+// Principal — аутентифицированный пользователь запроса
+type Principal struct {
+	Subject string
+	Role    string
+	// expires — срок действия учетных данных (exp из JWT); нулевой — бессрочно
+	expires time.Time
+}
+
+// Can сообщает, есть ли у пользователя право perm
+func (p *Principal) Can(perm Permission) bool {
+	for _, granted := range rolePermissions[p.Role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymous — пользователь запросов при AUTH_DISABLED=true. Ему доступно
+// только чтение: прием заказов, администрирование и персональные данные
+// без аутентификации недоступны никогда.
+var anonymous = &Principal{Subject: "anonymous", Role: RoleViewer}
+
+// AuthConfig — настройки аутентификации
+type AuthConfig struct {
+	// APIKeys — статические ключи в виде "ключ:роль,ключ:роль"
+	APIKeys string
+	// JWTSecret — общий секрет для токенов HS256
+	JWTSecret string
+	// JWKSFile — файл JWKS с открытыми ключами RSA для токенов RS256
+	JWKSFile string
+	// JWTIssuer и JWTAudience, если заданы, проверяются в токене
+	JWTIssuer   string
+	JWTAudience string
+	// RoleClaim — claim токена с ролью пользователя
+	RoleClaim string
+	// SessionSecret подписывает токены cookie сессии. Если не задан,
+	// создается случайный: сессии действуют только на этом экземпляре и до
+	// его перезапуска.
+	SessionSecret string
+	// Disabled явно отключает аутентификацию (AUTH_DISABLED=true): все
+	// запросы выполняются с ролью viewer
+	Disabled bool
+}
+
+// Authenticator проверяет API-ключи и JWT
+type Authenticator struct {
+	apiKeys   map[[sha256.Size]byte]string
+	secret    []byte
+	rsaKeys   map[string]*rsa.PublicKey
+	parser    *jwt.Parser
+	roleClaim string
+	// sessionKey — ключ HMAC токенов сессии
+	sessionKey []byte
+}
+
+// NewAuthenticator создает аутентификатор. Без единого способа
+// аутентификации возвращает ошибку, а при cfg.Disabled — nil: API доступен
+// без учетных данных только для чтения.
+func NewAuthenticator(cfg AuthConfig) (*Authenticator, error) {
+	configured := cfg.APIKeys != "" || cfg.JWTSecret != "" || cfg.JWKSFile != ""
+	switch {
+	case cfg.Disabled && configured:
+		return nil, errors.New("AUTH_DISABLED=true несовместим с AUTH_API_KEYS, AUTH_JWT_SECRET и AUTH_JWKS_FILE")
+	case cfg.Disabled:
+		return nil, nil
+	case !configured:
+		return nil, errors.New("аутентификация не настроена: задайте AUTH_API_KEYS, AUTH_JWT_SECRET или AUTH_JWKS_FILE " +
+			"(или AUTH_DISABLED=true для доступа без учетных данных только на чтение)")
+	}
+
+	a := &Authenticator{
+		apiKeys:   make(map[[sha256.Size]byte]string),
+		secret:    []byte(cfg.JWTSecret),
+		rsaKeys:   make(map[string]*rsa.PublicKey),
+		roleClaim: cfg.RoleClaim,
+	}
+	if a.roleClaim == "" {
+		a.roleClaim = "role"
+	}
+	a.sessionKey = []byte(cfg.SessionSecret)
+	if len(a.sessionKey) == 0 {
+		a.sessionKey = make([]byte, 32)
+		if _, err := rand.Read(a.sessionKey); err != nil {
+			return nil, fmt.Errorf("ошибка создания ключа сессий: %w", err)
+		}
+	}
+
+	for _, pair := range strings.Split(cfg.APIKeys, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, role, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || key == "" || rolePermissions[role] == nil {
+			return nil, fmt.Errorf("некорректный API-ключ %q: ожидается ключ:роль, роль — viewer, support или admin", maskKey(key))
+		}
+		a.apiKeys[sha256.Sum256([]byte(key))] = role
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+
+	var methods []string
+	if len(a.secret) > 0 {
+		methods = append(methods, "HS256")
+	}
+	if len(a.rsaKeys) > 0 {
+		methods = append(methods, "RS256")
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+// sessionCookie — cookie, в которой страница сервиса хранит токен сессии
+// для EventSource и WebSocket: браузер не позволяет задать им заголовки
+const sessionCookie = "orders_session"
+
+// sessionTTL — срок действия сессии; для JWT — не дольше самого токена
+const sessionTTL = 12 * time.Hour
+
+// sessionClaims — содержимое токена сессии. Сами учетные данные в cookie не
+// попадают: токен лишь подтверждает, кто и с какой ролью его получил.
+type sessionClaims struct {
+	Subject string `json:"sub"`
+	Role    string `json:"role"`
+	Expires int64  `json:"exp"`
+}
+
+// newSession выдает токен сессии для пользователя p: base64url JSON
+// sessionClaims и HMAC-SHA256 от него через точку
+func (a *Authenticator) newSession(p *Principal, now time.Time) (string, time.Time) {
+	expires := now.Add(sessionTTL)
+	if !p.expires.IsZero() && p.expires.Before(expires) {
+		expires = p.expires
+	}
+	data, _ := json.Marshal(sessionClaims{Subject: p.Subject, Role: p.Role, Expires: expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.sign(payload)), expires
+}
+
+// session проверяет подпись и срок действия токена сессии
+func (a *Authenticator) session(token string, now time.Time) (*Principal, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if !ok || err != nil || !hmac.Equal(mac, a.sign(payload)) {
+		return nil, fmt.Errorf("%w: недействительная сессия", ErrUnauthenticated)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: недействительная сессия", ErrUnauthenticated)
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(data, &claims); err != nil || rolePermissions[claims.Role] == nil {
+		return nil, fmt.Errorf("%w: недействительная сессия", ErrUnauthenticated)
+	}
+	if now.Unix() >= claims.Expires {
+		return nil, fmt.Errorf("%w: срок действия сессии истек", ErrUnauthenticated)
+	}
+	return &Principal{Subject: claims.Subject, Role: claims.Role, expires: time.Unix(claims.Expires, 0)}, nil
+}
+
+// sign вычисляет HMAC-SHA256 полезной нагрузки токена сессии
+func (a *Authenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Authenticate определяет пользователя запроса по заголовку X-API-Key,
+// Authorization: Bearer, cookie сессии (только для GET) или параметру
+// access_token. В адресе запроса принимается только JWT: адреса попадают в
+// журналы прокси, и долгоживущий API-ключ там оказаться не должен.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.apiKey(key)
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.credential(strings.TrimSpace(token))
+	}
+	// Cookie отправляется браузером автоматически, поэтому она не дает права
+	// на изменяющие запросы (SameSite=Strict дополнительно защищает от CSRF)
+	if cookie, err := r.Cookie(sessionCookie); err == nil && cookie.Value != "" &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		return a.session(cookie.Value, time.Now())
+	}
+	if token := strings.TrimSpace(r.URL.Query().Get("access_token")); token != "" {
+		if _, ok := a.apiKeys[sha256.Sum256([]byte(token))]; ok {
+			return nil, fmt.Errorf("%w: API-ключ нельзя передавать в адресе запроса, используйте заголовок X-API-Key", ErrUnauthenticated)
+		}
+		return a.jwt(token)
+	}
+	return nil, ErrUnauthenticated
+}
+
+// credential проверяет значение, которое может быть API-ключом или JWT
+func (a *Authenticator) credential(token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	if role, ok := a.apiKeys[sha256.Sum256([]byte(token))]; ok {
+		return &Principal{Subject: apiKeySubject(token), Role: role}, nil
+	}
+	return a.jwt(token)
+}
+
+// handleCreateSession выдает по учетным данным из заголовка запроса токен
+// сессии в HttpOnly-cookie, чтобы страница сервиса могла открывать поток
+// событий. Сам API-ключ или JWT в cookie не сохраняется.
+func (s *Server) handleCreateSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			// Без аутентификации cookie не нужна
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Header.Get("X-API-Key") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "учетные данные передаются заголовком X-API-Key или Authorization")
+			return
+		}
+		token, expires := s.auth.newSession(principalFrom(r.Context()), time.Now())
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/api/",
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleDeleteSession удаляет cookie сессии
+func (s *Server) handleDeleteSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Path:     "/api/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *Authenticator) apiKey(key string) (*Principal, error) {
+	role, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, fmt.Errorf("%w: неизвестный API-ключ", ErrUnauthenticated)
+	}
+	return &Principal{Subject: apiKeySubject(key), Role: role}, nil
+}
+
+func (a *Authenticator) jwt(token string) (*Principal, error) {
+	if len(a.secret) == 0 && len(a.rsaKeys) == 0 {
+		return nil, fmt.Errorf("%w: неизвестный API-ключ", ErrUnauthenticated)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.Alg() {
+		case "HS256":
+			return a.secret, nil
+		case "RS256":
+			kid, _ := t.Header["kid"].(string)
+			if key, ok := a.rsaKeys[kid]; ok {
+				return key, nil
+			}
+			return nil, fmt.Errorf("неизвестный kid %q", kid)
+		}
+		return nil, fmt.Errorf("неподдерживаемый алгоритм %s", t.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	role, _ := claims[a.roleClaim].(string)
+	if rolePermissions[role] == nil {
+		return nil, fmt.Errorf("%w: в токене нет известной роли (%s)", ErrForbidden, a.roleClaim)
+	}
+	principal := &Principal{Subject: subject, Role: role}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		principal.expires = exp.Time
+	}
+	return principal, nil
+}
+
+// loadJWKS читает открытые ключи RSA из файла JWKS
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения JWKS: %w", err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("ошибка разбора JWKS %s: %w", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			return nil, fmt.Errorf("ключ %q в JWKS: некорректные n или e", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("в JWKS %s нет ключей RSA", path)
+	}
+	return keys, nil
+}
+
+// apiKeySubject — пользователь запроса с API-ключом: начало ключа и отпечаток
+// его SHA-256. Ключи с одинаковым началом — разные пользователи, в том числе
+// для ограничения частоты запросов.
+func apiKeySubject(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "api-key:" + maskKey(key) + ":" + hex.EncodeToString(sum[:4])
+}
+
+// maskKey оставляет от ключа только начало, чтобы его можно было узнать в логах
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
+
+type principalKey struct{}
+
+// principalFrom возвращает пользователя запроса. Без аутентификации это
+// анонимный пользователь с ролью viewer.
+func principalFrom(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return anonymous
+}
+
+// require пропускает запрос, только если у пользователя есть право perm
+func (s *Server) require(perm Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			if !anonymous.Can(perm) {
+				writeProblem(w, r, http.StatusForbidden, CodeForbidden, "аутентификация отключена: доступно только чтение")
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		// Адрес, исчерпавший лимит неудачных попыток, не проверяется вовсе:
+		// иначе верный ключ можно было бы подобрать, не обращая внимания на 429
+		ip := s.clientIP(r)
+		if s.limiter != nil {
+			if wait := s.limiter.Wait(RouteGroupAuth, ip); wait > 0 {
+				rateLimited(w, r, RouteGroupAuth, wait)
+				return
+			}
+		}
+
+		principal, err := s.auth.Authenticate(r)
+		if err != nil && s.limiter != nil {
+			s.limiter.Allow(RouteGroupAuth, ip)
+		}
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="orders"`)
+			writeProblem(w, r, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+			return
+		case err != nil:
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, err.Error())
+			return
+		case !principal.Can(perm):
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "роль "+principal.Role)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
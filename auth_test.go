@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthenticatorRequiresConfiguration(t *testing.T) {
+	if _, err := NewAuthenticator(AuthConfig{}); err == nil {
+		t.Error("без способов аутентификации ожидалась ошибка")
+	}
+	if auth, err := NewAuthenticator(AuthConfig{Disabled: true}); err != nil || auth != nil {
+		t.Errorf("AUTH_DISABLED: auth=%v, err=%v", auth, err)
+	}
+	if _, err := NewAuthenticator(AuthConfig{Disabled: true, APIKeys: "k:admin"}); err == nil {
+		t.Error("AUTH_DISABLED вместе с ключами: ожидалась ошибка")
+	}
+}
+
+func TestDisabledAuthIsReadOnly(t *testing.T) {
+	router := NewServer(NewOrderCache(), nil, nil).router
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/order/missing", http.StatusNotFound},
+		{http.MethodPost, "/api/orders", http.StatusForbidden},
+		{http.MethodPost, "/api/admin/replay", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: статус %d, ожидался %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestAuthenticateCredentialSources(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "secret-key:viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := auth.newSession(&Principal{Subject: "api-key:secr****", Role: RoleViewer}, time.Now())
+	cookie := &http.Cookie{Name: sessionCookie, Value: token}
+
+	for _, tc := range []struct {
+		name string
+		req  func() *http.Request
+		ok   bool
+	}{
+		{"заголовок", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+			r.Header.Set("X-API-Key", "secret-key")
+			return r
+		}, true},
+		{"API-ключ в адресе", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/api/orders/stream?access_token=secret-key", nil)
+		}, false},
+		{"cookie в GET", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/orders/stream", nil)
+			r.AddCookie(cookie)
+			return r
+		}, true},
+		{"cookie в POST", func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+			r.AddCookie(cookie)
+			return r
+		}, false},
+		{"API-ключ в cookie", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/api/orders/stream", nil)
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "secret-key"})
+			return r
+		}, false},
+	} {
+		_, err := auth.Authenticate(tc.req())
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err=%v", tc.name, err)
+		}
+	}
+}
+
+func TestFailedAuthenticationIsRateLimited(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "secret-key:viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetAuthenticator(auth)
+	s.SetLimits(NewRateLimiter(map[string]Limit{RouteGroupAuth: {Rate: 0.001, Burst: 3}}), 1<<20)
+
+	get := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/order/missing", nil)
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	for i := 0; i < 3; i++ {
+		if code := get("guess"); code != http.StatusUnauthorized {
+			t.Fatalf("попытка %d: статус %d, ожидался 401", i+1, code)
+		}
+	}
+	// После исчерпания лимита не проверяется даже верный ключ
+	if code := get("secret-key"); code != http.StatusTooManyRequests {
+		t.Errorf("верный ключ после перебора: статус %d, ожидался 429", code)
+	}
+}
+
+func TestSessionCookieHoldsNoCredential(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "secret-key:support", JWTSecret: "jwt-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetAuthenticator(auth)
+
+	createSession := func(header, value string) *http.Cookie {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/api/session", nil)
+		r.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("POST /api/session: статус %d: %s", rec.Code, rec.Body)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+			t.Fatalf("cookie сессии: %+v", cookies)
+		}
+		return cookies[0]
+	}
+
+	cookie := createSession("X-API-Key", "secret-key")
+	if strings.Contains(cookie.Value, "secret-key") {
+		t.Errorf("cookie содержит API-ключ: %s", cookie.Value)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/orders/stream", nil)
+	r.AddCookie(cookie)
+	if p, err := auth.Authenticate(r); err != nil || p.Role != RoleSupport {
+		t.Errorf("сессия по API-ключу: %+v, %v", p, err)
+	}
+
+	// Сессия по JWT живет не дольше самого токена
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	jwtToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice", "role": RoleViewer, "exp": exp.Unix(),
+	}).SignedString([]byte("jwt-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie = createSession("Authorization", "Bearer "+jwtToken)
+	if strings.Contains(cookie.Value, jwtToken) {
+		t.Error("cookie содержит JWT")
+	}
+	if !cookie.Expires.Equal(exp) {
+		t.Errorf("срок cookie %s, ожидался срок токена %s", cookie.Expires, exp)
+	}
+	if _, err := auth.session(cookie.Value, exp); err == nil {
+		t.Error("сессия действует после истечения JWT")
+	}
+	if p, err := auth.session(cookie.Value, time.Now()); err != nil || p.Subject != "alice" || p.Role != RoleViewer {
+		t.Errorf("сессия по JWT: %+v, %v", p, err)
+	}
+}
+
+func TestSessionTokenVerification(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "k:viewer", SessionSecret: "session-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	token, expires := auth.newSession(&Principal{Subject: "api-key:k****", Role: RoleViewer}, now)
+	if !expires.Equal(now.Add(sessionTTL)) {
+		t.Errorf("срок сессии %s", expires)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+	admin, _ := auth.newSession(&Principal{Subject: "api-key:k****", Role: RoleAdmin}, now)
+	adminPayload, _, _ := strings.Cut(admin, ".")
+	other, err := NewAuthenticator(AuthConfig{APIKeys: "k:viewer", SessionSecret: "other-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		auth  *Authenticator
+		token string
+		at    time.Time
+	}{
+		{"подмена роли", auth, adminPayload + "." + sig, now},
+		{"без подписи", auth, payload, now},
+		{"чужой ключ", other, token, now},
+		{"истекшая", auth, token, expires},
+	} {
+		if _, err := tc.auth.session(tc.token, tc.at); err == nil {
+			t.Errorf("%s: сессия принята", tc.name)
+		}
+	}
+	if p, err := auth.session(token, now); err != nil || p.Role != RoleViewer {
+		t.Errorf("действующая сессия: %+v, %v", p, err)
+	}
+}
+
+func TestOrderResponseVariesByCredentials(t *testing.T) {
+	cache := NewOrderCache()
+	order := testOrder(t)
+	cache.Set(order.OrderUID, order)
+	rec := getOrder(t, newTestServer(t, cache).router, order.OrderUID, "", "")
+	vary := strings.Join(rec.Header().Values("Vary"), ", ")
+	for _, header := range []string{"Authorization", "X-API-Key", "Cookie"} {
+		if !strings.Contains(vary, header) {
+			t.Errorf("Vary %q не содержит %s", vary, header)
+		}
+	}
+}
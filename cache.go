@@ -1,31 +1,78 @@
 package main
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
     "sync"
+    "time"
 )
 
+// CachedOrder — заказ в кэше вместе с готовым JSON-представлением и данными
+// для условных запросов: ETag — хэш JSON, Modified — момент последнего изменения
+type CachedOrder struct {
+    Order    *Order
+    JSON     []byte
+    ETag     string
+    Modified time.Time
+}
+
+// newCachedOrder сериализует заказ. Время изменения берется из БД
+// (updated_at), поэтому Last-Modified одинаков на всех экземплярах и не
+// меняется при перезапуске; для заказа, еще не сохраненного в БД, — date_created.
+func newCachedOrder(order *Order) *CachedOrder {
+    body, etag := presentedJSON(order)
+    modified := order.UpdatedAt
+    if modified.IsZero() {
+        modified = order.DateCreated
+    }
+    return &CachedOrder{
+        Order:    order,
+        JSON:     body,
+        ETag:     etag,
+        Modified: modified.UTC(),
+    }
+}
+
+// presentedJSON сериализует заказ и вычисляет ETag по полученному JSON
+func presentedJSON(order *Order) ([]byte, string) {
+    // Order состоит из строк, чисел и времени, поэтому сериализуется без ошибок
+    body, _ := json.Marshal(order)
+    sum := sha256.Sum256(body)
+    return body, `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
 type OrderCache struct {
     mu     sync.RWMutex
-    orders map[string]*Order
+    orders map[string]*CachedOrder
 }
 
 func NewOrderCache() *OrderCache {
     return &OrderCache{
-        orders: make(map[string]*Order),
+        orders: make(map[string]*CachedOrder),
     }
 }
 
 func (c *OrderCache) Set(orderUID string, order *Order) {
     c.mu.Lock()
     defer c.mu.Unlock()
-    c.orders[orderUID] = order
+    c.orders[orderUID] = newCachedOrder(order)
 }
 
 func (c *OrderCache) Get(orderUID string) (*Order, bool) {
+    entry, exists := c.Lookup(orderUID)
+    if !exists {
+        return nil, false
+    }
+    return entry.Order, true
+}
+
+// Lookup возвращает заказ вместе с JSON, ETag и временем изменения
+func (c *OrderCache) Lookup(orderUID string) (*CachedOrder, bool) {
     c.mu.RLock()
     defer c.mu.RUnlock()
-    order, exists := c.orders[orderUID]
-    return order, exists
+    entry, exists := c.orders[orderUID]
+    return entry, exists
 }
 
 func (c *OrderCache) Delete(orderUID string) {
@@ -38,8 +85,8 @@ func (c *OrderCache) GetAll() []*Order {
     c.mu.RLock()
     defer c.mu.RUnlock()
     orders := make([]*Order, 0, len(c.orders))
-    for _, order := range c.orders {
-        orders = append(orders, order)
+    for _, entry := range c.orders {
+        orders = append(orders, entry.Order)
     }
     return orders
 }
@@ -47,5 +94,23 @@ func (c *OrderCache) GetAll() []*Order {
 func (c *OrderCache) Clear() {
     c.mu.Lock()
     defer c.mu.Unlock()
-    c.orders = make(map[string]*Order)
-}
\ No newline at end of file
+    c.orders = make(map[string]*CachedOrder)
+}
+
+// Replace атомарно заменяет содержимое кэша переданными заказами. Сборка и
+// замена выполняются под одной блокировкой; заказ, сохраненный после чтения
+// orders из БД (более новый updated_at), не затирается старой версией.
+func (c *OrderCache) Replace(orders []*Order) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    fresh := make(map[string]*CachedOrder, len(orders))
+    for _, order := range orders {
+        entry := newCachedOrder(order)
+        if current, ok := c.orders[order.OrderUID]; ok && current.Modified.After(entry.Modified) {
+            entry = current
+        }
+        fresh[order.OrderUID] = entry
+    }
+    c.orders = fresh
+}
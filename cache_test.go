@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// generation возвращает n заказов с префиксом order_uid prefix
+func generation(t *testing.T, prefix string, n int) []*Order {
+	t.Helper()
+	orders := make([]*Order, n)
+	for i := range orders {
+		orders[i] = testOrder(t)
+		orders[i].OrderUID = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return orders
+}
+
+func TestCacheReplaceIsAtomic(t *testing.T) {
+	cache := NewOrderCache()
+	for _, order := range generation(t, "old", 100) {
+		cache.Set(order.OrderUID, order)
+	}
+	fresh := generation(t, "new", 100)
+
+	// Читатели видят либо весь старый набор, либо весь новый
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				orders := cache.GetAll()
+				if len(orders) != 100 {
+					t.Errorf("в кэше %d заказов", len(orders))
+					return
+				}
+				prefix, _, _ := strings.Cut(orders[0].OrderUID, "-")
+				for _, order := range orders {
+					if !strings.HasPrefix(order.OrderUID, prefix+"-") {
+						t.Errorf("смешаны заказы %s и %s", orders[0].OrderUID, order.OrderUID)
+						return
+					}
+				}
+			}
+		}()
+	}
+	cache.Replace(fresh)
+	close(done)
+	wg.Wait()
+
+	if _, ok := cache.Get("old-0"); ok {
+		t.Error("заказ, которого нет в новом наборе, остался в кэше")
+	}
+	if _, ok := cache.Get("new-99"); !ok {
+		t.Error("заказ из нового набора не попал в кэш")
+	}
+}
+
+func TestCacheReplaceKeepsNewerOrder(t *testing.T) {
+	cache := NewOrderCache()
+	loaded := testOrder(t)
+	loaded.UpdatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Заказ сохранен после того, как набор для Replace был прочитан из БД
+	saved := testOrder(t)
+	saved.UpdatedAt = loaded.UpdatedAt.Add(time.Minute)
+	saved.TrackNumber = "NEWER"
+	cache.Set(saved.OrderUID, saved)
+
+	cache.Replace([]*Order{loaded})
+	if got, _ := cache.Get(loaded.OrderUID); got.TrackNumber != "NEWER" {
+		t.Errorf("более новая версия заказа затерта: %s", got.TrackNumber)
+	}
+
+	older := testOrder(t)
+	older.UpdatedAt = loaded.UpdatedAt.Add(-time.Minute)
+	cache.Set(older.OrderUID, older)
+	cache.Replace([]*Order{loaded})
+	if entry, _ := cache.Lookup(loaded.OrderUID); !entry.Modified.Equal(loaded.UpdatedAt) {
+		t.Errorf("версия из БД не заменила старую: %s", entry.Modified)
+	}
+}
@@ -0,0 +1,348 @@
+// Package client — Go-клиент HTTP API сервиса заказов.
+//
+//	c := client.New("http://localhost:8080")
+//	order, err := c.GetOrder(ctx, "b583feb7b2b84b6test")
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"orders-service/model"
+)
+
+// Client — клиент HTTP API сервиса заказов. Безопасен для конкурентного использования.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	apiKey     string
+	token      string
+}
+
+// Option настраивает клиент
+type Option func(*Client)
+
+// WithHTTPClient задает HTTP-клиент (таймауты, транспорт)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries задает число повторов при ответах 5xx, 429 и сетевых ошибках и
+// начальную паузу между ними; пауза удваивается с каждой попыткой, но не
+// бывает короче Retry-After из ответа сервиса
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithAPIKey передает статический API-ключ в заголовке X-API-Key
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithToken передает JWT в заголовке Authorization: Bearer
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// New создает клиент для сервиса по адресу baseURL, например http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		retries:    3,
+		backoff:    200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetOrder возвращает заказ по order_uid. Если заказа нет, ошибка
+// удовлетворяет errors.Is(err, ErrNotFound).
+func (c *Client) GetOrder(ctx context.Context, uid string) (*model.Order, error) {
+	var order model.Order
+	if err := c.do(ctx, http.MethodGet, "/api/order/"+url.PathEscape(uid), nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListOptions — фильтры и страница списка заказов. Пустые поля не передаются.
+type ListOptions struct {
+	CustomerID      string
+	DeliveryService string
+	Limit           int
+	Offset          int
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.CustomerID != "" {
+		q.Set("customer_id", o.CustomerID)
+	}
+	if o.DeliveryService != "" {
+		q.Set("delivery_service", o.DeliveryService)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return q
+}
+
+// OrderList — страница списка заказов, новые первыми
+type OrderList struct {
+	Orders []*model.Order `json:"orders"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// ListOrders возвращает страницу заказов, отфильтрованных по opts
+func (c *Client) ListOrders(ctx context.Context, opts ListOptions) (*OrderList, error) {
+	path := "/api/orders"
+	if q := opts.query().Encode(); q != "" {
+		path += "?" + q
+	}
+	var list OrderList
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// SearchOptions — страница результатов поиска
+type SearchOptions struct {
+	Limit  int
+	Offset int
+}
+
+// SearchResult — найденный заказ; в Highlights совпадения выделены тегом
+// <mark>, остальной текст экранирован как HTML
+type SearchResult struct {
+	Order      *model.Order `json:"order"`
+	Rank       float64      `json:"rank"`
+	Highlights []string     `json:"highlights"`
+}
+
+// SearchPage — страница результатов поиска, самые релевантные первыми
+type SearchPage struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Backend string         `json:"backend"`
+}
+
+// Search ищет заказы по имени покупателя, городу, региону, названию и бренду
+// товаров (требуется право на просмотр персональных данных)
+func (c *Client) Search(ctx context.Context, query string, opts SearchOptions) (*SearchPage, error) {
+	q := url.Values{"q": {query}}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	var page SearchPage
+	if err := c.do(ctx, http.MethodGet, "/api/search?"+q.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// IngestResult — результат приема заказа: applied, skipped (заказ не изменился)
+type IngestResult struct {
+	OrderUID string `json:"order_uid"`
+	Outcome  string `json:"outcome"`
+}
+
+// IngestOrder отправляет заказ в сервис в обход NATS. Заказ, не прошедший
+// проверку, возвращает *ValidationError.
+func (c *Client) IngestOrder(ctx context.Context, order *model.Order) (*IngestResult, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации заказа: %w", err)
+	}
+	return c.IngestRaw(ctx, data)
+}
+
+// IngestRaw отправляет сообщение как есть: JSON-заказ, конверт или protobuf
+func (c *Client) IngestRaw(ctx context.Context, data []byte) (*IngestResult, error) {
+	var result IngestResult
+	if err := c.do(ctx, http.MethodPost, "/api/orders", data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReplayRequest задает, с какого места канала повторно обработать сообщения.
+// Должно быть задано ровно одно из FromBeginning, FromSequence и FromTime.
+type ReplayRequest struct {
+	FromBeginning bool       `json:"from_beginning,omitempty"`
+	FromSequence  uint64     `json:"from_sequence,omitempty"`
+	FromTime      *time.Time `json:"from_time,omitempty"`
+	ToSequence    uint64     `json:"to_sequence,omitempty"`
+	DryRun        bool       `json:"dry_run,omitempty"`
+	IdleSeconds   int        `json:"idle_seconds,omitempty"`
+}
+
+// ReplayReport — итог повторного проигрывания канала
+type ReplayReport struct {
+	Channel       string `json:"channel"`
+	DryRun        bool   `json:"dry_run"`
+	Applied       int    `json:"applied"`
+	Skipped       int    `json:"skipped"`
+	Rejected      int    `json:"rejected"`
+	Failed        int    `json:"failed"`
+	FirstSequence uint64 `json:"first_sequence"`
+	LastSequence  uint64 `json:"last_sequence"`
+	Duration      string `json:"duration"`
+}
+
+// Replay повторно проигрывает канал NATS (административный вызов). Запрос
+// не повторяется при ошибках, чтобы не запустить проигрывание дважды.
+func (c *Client) Replay(ctx context.Context, req ReplayRequest) (*ReplayReport, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+	var report ReplayReport
+	if err := c.send(ctx, http.MethodPost, "/api/admin/replay", data, &report, 0); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ErasureRequest — запрос на удаление данных покупателя. Mode — anonymize
+// (стереть персональные данные, сохранив заказы) или delete.
+type ErasureRequest struct {
+	CustomerID string `json:"customer_id"`
+	Mode       string `json:"mode"`
+	Reason     string `json:"reason,omitempty"`
+	DryRun     bool   `json:"dry_run,omitempty"`
+}
+
+// ErasureReport — итог удаления данных покупателя
+type ErasureReport struct {
+	AuditID     int64     `json:"audit_id"`
+	Mode        string    `json:"mode"`
+	DryRun      bool      `json:"dry_run"`
+	Orders      []string  `json:"orders"`
+	DeadLetters int64     `json:"dead_letters"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// EraseCustomer удаляет или обезличивает все данные покупателя
+// (административный вызов, не повторяется)
+func (c *Client) EraseCustomer(ctx context.Context, req ErasureRequest) (*ErasureReport, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+	var report ErasureReport
+	if err := c.send(ctx, http.MethodPost, "/api/admin/erasure", data, &report, 0); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// do выполняет запрос с повторами по настройкам клиента
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out any) error {
+	return c.send(ctx, method, path, body, out, c.retries)
+}
+
+// send выполняет запрос, повторяя его до retries раз при сетевых ошибках и
+// ответах 5xx и 429, и декодирует JSON-ответ в out
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out any, retries int) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, path, body, out)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+
+		wait := backoff
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &networkError{err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &networkError{err: err}
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := newAPIError(method, path, resp.StatusCode, resp.Header.Get("Content-Type"), data)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			var target *APIError
+			if errors.As(apiErr, &target) {
+				target.RetryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("ошибка разбора ответа %s %s: %w", method, path, err)
+	}
+	return nil
+}
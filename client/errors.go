@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound — запрошенный объект не найден (HTTP 404)
+var ErrNotFound = errors.New("не найдено")
+
+// Коды ошибок API (поле code ответа application/problem+json)
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeOrderNotFound    = "order_not_found"
+	CodeWebhookNotFound  = "webhook_not_found"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidOrder     = "invalid_order"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeUnavailable      = "unavailable"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+)
+
+// APIError — ответ сервиса с кодом ошибки
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Code — стабильный код ошибки; пуст, если ответ не в формате problem+json
+	Code string
+	// Message — сообщение об ошибке на языке ответа
+	Message string
+	// Detail — подробности, например причина отказа в приеме заказа
+	Detail    string
+	RequestID string
+	// RetryAfter — через сколько сервис разрешает повторить запрос (для 429 и 503)
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request_id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Is позволяет проверять 404 через errors.Is(err, ErrNotFound)
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// ValidationError — сервис отклонил заказ как некорректный (HTTP 422)
+type ValidationError struct {
+	APIError
+}
+
+func (e *ValidationError) Error() string {
+	if e.Detail == "" {
+		return "заказ отклонен: " + e.Message
+	}
+	return "заказ отклонен: " + e.Detail
+}
+
+// Unwrap возвращает исходную ошибку API
+func (e *ValidationError) Unwrap() error {
+	return &e.APIError
+}
+
+// networkError — запрос не дошел до сервиса или ответ не был получен целиком
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string { return e.err.Error() }
+func (e *networkError) Unwrap() error { return e.err }
+
+// problem — тело ответа application/problem+json
+type problem struct {
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id"`
+}
+
+func newAPIError(method, path string, status int, contentType string, body []byte) error {
+	apiErr := APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: status,
+		Message:    strings.TrimSpace(string(body)),
+	}
+	var p problem
+	if strings.HasPrefix(contentType, "application/problem+json") && json.Unmarshal(body, &p) == nil {
+		apiErr.Code, apiErr.Message, apiErr.Detail, apiErr.RequestID = p.Code, p.Title, p.Detail, p.RequestID
+	}
+	if status == http.StatusUnprocessableEntity {
+		return &ValidationError{APIError: apiErr}
+	}
+	return &apiErr
+}
+
+// retryable сообщает, имеет ли смысл повторить запрос
+func retryable(err error) bool {
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) &&
+		(apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests)
+}
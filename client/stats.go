@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StatsOptions — диапазон отчета. Без From и Period сервис берет последние
+// 30 дней; From и Period взаимоисключающие.
+type StatsOptions struct {
+	From   time.Time
+	To     time.Time
+	Period string
+	// Limit — сколько брендов и товаров вернуть в StatsTop
+	Limit int
+}
+
+func (o StatsOptions) query() url.Values {
+	q := url.Values{}
+	if !o.From.IsZero() {
+		q.Set("from", o.From.Format(time.RFC3339))
+	}
+	if !o.To.IsZero() {
+		q.Set("to", o.To.Format(time.RFC3339))
+	}
+	if o.Period != "" {
+		q.Set("period", o.Period)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return q
+}
+
+// StatsRange — диапазон дат создания заказов [From, To)
+type StatsRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// CurrencyTotal — выручка в одной валюте
+type CurrencyTotal struct {
+	Currency string  `json:"currency"`
+	Orders   int64   `json:"orders"`
+	Revenue  int64   `json:"revenue"`
+	AvgOrder float64 `json:"avg_order"`
+	AvgGoods float64 `json:"avg_goods"`
+}
+
+// StatsSummary — общие показатели за диапазон
+type StatsSummary struct {
+	StatsRange
+	Orders      int64           `json:"orders"`
+	Revenue     []CurrencyTotal `json:"revenue"`
+	AvgItems    float64         `json:"avg_items"`
+	AvgSale     float64         `json:"avg_sale"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// DailyRevenue — выручка за день (UTC) в одной валюте
+type DailyRevenue struct {
+	Day      string `json:"day"`
+	Currency string `json:"currency"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+}
+
+// StatsRevenue — выручка по дням
+type StatsRevenue struct {
+	StatsRange
+	Days        []DailyRevenue `json:"days"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// StatsCount — число заказов с одним значением поля
+type StatsCount struct {
+	Value  string `json:"value"`
+	Orders int64  `json:"orders"`
+}
+
+// StatsBreakdown — распределение заказов по полям доставки и заказа
+type StatsBreakdown struct {
+	StatsRange
+	DeliveryService []StatsCount `json:"delivery_service"`
+	Locale          []StatsCount `json:"locale"`
+	Entry           []StatsCount `json:"entry"`
+	Region          []StatsCount `json:"region"`
+	GeneratedAt     time.Time    `json:"generated_at"`
+}
+
+// TopBrand — бренд с числом проданных единиц и выручкой по валютам
+type TopBrand struct {
+	Brand   string           `json:"brand"`
+	Items   int64            `json:"items"`
+	Orders  int64            `json:"orders"`
+	Revenue map[string]int64 `json:"revenue"`
+}
+
+// TopItem — товар с числом проданных единиц и выручкой по валютам
+type TopItem struct {
+	NmID    int64            `json:"nm_id"`
+	Name    string           `json:"name"`
+	Brand   string           `json:"brand"`
+	Items   int64            `json:"items"`
+	Orders  int64            `json:"orders"`
+	Revenue map[string]int64 `json:"revenue"`
+}
+
+// StatsTop — самые продаваемые бренды и товары
+type StatsTop struct {
+	StatsRange
+	Brands      []TopBrand `json:"brands"`
+	Items       []TopItem  `json:"items"`
+	GeneratedAt time.Time  `json:"generated_at"`
+}
+
+// StatsSummary возвращает общие показатели заказов
+func (c *Client) StatsSummary(ctx context.Context, opts StatsOptions) (*StatsSummary, error) {
+	var report StatsSummary
+	if err := c.stats(ctx, "summary", opts, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StatsRevenue возвращает выручку по дням и валютам
+func (c *Client) StatsRevenue(ctx context.Context, opts StatsOptions) (*StatsRevenue, error) {
+	var report StatsRevenue
+	if err := c.stats(ctx, "revenue", opts, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StatsBreakdown возвращает распределение заказов по службе доставки,
+// локали, точке входа и региону
+func (c *Client) StatsBreakdown(ctx context.Context, opts StatsOptions) (*StatsBreakdown, error) {
+	var report StatsBreakdown
+	if err := c.stats(ctx, "breakdown", opts, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StatsTop возвращает самые продаваемые бренды и товары
+func (c *Client) StatsTop(ctx context.Context, opts StatsOptions) (*StatsTop, error) {
+	var report StatsTop
+	if err := c.stats(ctx, "top", opts, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) stats(ctx context.Context, report string, opts StatsOptions, out any) error {
+	path := "/api/stats/" + report
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return c.do(ctx, http.MethodGet, path, nil, out)
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"orders-service/model"
+)
+
+// ErrInvalidSignature — подпись вебхука не совпала или устарела
+var ErrInvalidSignature = errors.New("неверная подпись вебхука")
+
+// WebhookRequest — регистрация вебхука. Events — order.created и/или
+// order.updated; пустые фильтры пропускают все события. Если Secret не задан,
+// сервис генерирует его сам.
+type WebhookRequest struct {
+	URL             string   `json:"url"`
+	Events          []string `json:"events,omitempty"`
+	CustomerID      string   `json:"customer_id,omitempty"`
+	DeliveryService string   `json:"delivery_service,omitempty"`
+	Secret          string   `json:"secret,omitempty"`
+}
+
+// Webhook — зарегистрированный вебхук. Secret заполнен только в ответе
+// CreateWebhook.
+type Webhook struct {
+	ID              int64     `json:"id"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	CustomerID      string    `json:"customer_id,omitempty"`
+	DeliveryService string    `json:"delivery_service,omitempty"`
+	Secret          string    `json:"secret,omitempty"`
+	CreatedBy       string    `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// WebhookDelivery — доставка события на вебхук: pending, delivered или failed
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int64            `json:"webhook_id"`
+	EventID        string           `json:"event_id"`
+	Event          string           `json:"event"`
+	OrderUID       string           `json:"order_uid"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookAttempt — одна попытка доставки
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+}
+
+// WebhookDeliveryList — страница журнала доставок, новые первыми
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+}
+
+// DeliveryOptions — фильтр и страница журнала доставок
+type DeliveryOptions struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// WebhookEvent — тело запроса, которое сервис отправляет на вебхук
+type WebhookEvent struct {
+	ID    string       `json:"id"`
+	Type  string       `json:"type"`
+	At    time.Time    `json:"at"`
+	Order *model.Order `json:"order"`
+}
+
+// CreateWebhook регистрирует вебхук (административный вызов, не повторяется)
+func (c *Client) CreateWebhook(ctx context.Context, req WebhookRequest) (*Webhook, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+	var hook Webhook
+	if err := c.send(ctx, http.MethodPost, "/api/admin/webhooks", data, &hook, 0); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// ListWebhooks возвращает зарегистрированные вебхуки
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var list struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/admin/webhooks", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Webhooks, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом доставок
+func (c *Client) DeleteWebhook(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/webhooks/"+strconv.FormatInt(id, 10), nil, nil)
+}
+
+// WebhookDeliveries возвращает страницу журнала доставок вебхука
+func (c *Client) WebhookDeliveries(ctx context.Context, id int64, opts DeliveryOptions) (*WebhookDeliveryList, error) {
+	q := url.Values{}
+	if opts.Status != "" {
+		q.Set("status", opts.Status)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	path := "/api/admin/webhooks/" + strconv.FormatInt(id, 10) + "/deliveries"
+	if encoded := q.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	var list WebhookDeliveryList
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// RetryWebhookDelivery возвращает доставку в очередь с немедленной попыткой
+func (c *Client) RetryWebhookDelivery(ctx context.Context, id, deliveryID int64) error {
+	path := fmt.Sprintf("/api/admin/webhooks/%d/deliveries/%d/retry", id, deliveryID)
+	return c.do(ctx, http.MethodPost, path, nil, nil)
+}
+
+// VerifyWebhook проверяет заголовок X-Webhook-Signature запроса от сервиса и
+// разбирает тело. tolerance — допустимый возраст подписи (0 — не проверять).
+//
+//	event, err := client.VerifyWebhook(secret, r.Header.Get("X-Webhook-Signature"), body, 5*time.Minute)
+func VerifyWebhook(secret, signature string, body []byte, tolerance time.Duration) (*WebhookEvent, error) {
+	var timestamp, sum string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sum = value
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sum == "" {
+		return nil, fmt.Errorf("%w: ожидается t=<время>,v1=<hex>", ErrInvalidSignature)
+	}
+	if tolerance > 0 && time.Since(time.Unix(ts, 0)).Abs() > tolerance {
+		return nil, fmt.Errorf("%w: подпись устарела", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	expected, err := hex.DecodeString(sum)
+	if err != nil || !hmac.Equal(expected, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("ошибка разбора события: %w", err)
+	}
+	return &event, nil
+}
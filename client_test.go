@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"orders-service/client"
+)
+
+// Проверки Go-клиента против настоящего роутера сервиса. Клиент лежит в
+// отдельном пакете, но Server — в main, поэтому тесты находятся здесь.
+
+const testAdminKey = "test-admin-key"
+
+// testOrder читает тестовый заказ из задания
+func testOrder(t *testing.T) *Order {
+	t.Helper()
+	data, err := os.ReadFile("model/testdata/order.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+	return &order
+}
+
+// newTestServer создает сервис без БД и NATS: заказы берутся из кэша
+func newTestServer(t *testing.T, cache *OrderCache) *Server {
+	t.Helper()
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: testAdminKey + ":" + RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(cache, NewOrderProcessor(nil, cache, false), nil)
+	s.SetAuthenticator(auth)
+	return s
+}
+
+func newTestClient(url string) *client.Client {
+	return client.New(url, client.WithAPIKey(testAdminKey), client.WithRetries(3, time.Millisecond))
+}
+
+func TestClientGetOrder(t *testing.T) {
+	cache := NewOrderCache()
+	order := testOrder(t)
+	cache.Set(order.OrderUID, order)
+	ts := httptest.NewServer(newTestServer(t, cache).router)
+	defer ts.Close()
+
+	got, err := newTestClient(ts.URL).GetOrder(context.Background(), order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if got.OrderUID != order.OrderUID || got.Payment.Amount != order.Payment.Amount || len(got.Items) != len(order.Items) {
+		t.Errorf("GetOrder вернул другой заказ: %+v", got)
+	}
+}
+
+func TestClientGetOrderNotFound(t *testing.T) {
+	ts := httptest.NewServer(newTestServer(t, NewOrderCache()).router)
+	defer ts.Close()
+
+	_, err := newTestClient(ts.URL).GetOrder(context.Background(), "missing")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("ожидалась ErrNotFound, получено %v", err)
+	}
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != client.CodeOrderNotFound || apiErr.RequestID == "" {
+		t.Errorf("ожидалась ошибка с кодом %s и request_id, получено %#v", client.CodeOrderNotFound, apiErr)
+	}
+}
+
+func TestClientIngestValidationError(t *testing.T) {
+	ts := httptest.NewServer(newTestServer(t, NewOrderCache()).router)
+	defer ts.Close()
+
+	order := testOrder(t)
+	order.Payment.Transaction = "other"
+	_, err := newTestClient(ts.URL).IngestOrder(context.Background(), order)
+
+	var validation *client.ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("ожидалась ValidationError, получено %v", err)
+	}
+	if validation.Code != client.CodeInvalidOrder || validation.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("неожиданная ошибка: %#v", validation.APIError)
+	}
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	cache := NewOrderCache()
+	order := testOrder(t)
+	cache.Set(order.OrderUID, order)
+	router := newTestServer(t, cache).router
+
+	// Первые два запроса завершаются ошибкой 503, третий доходит до роутера
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	got, err := newTestClient(ts.URL).GetOrder(context.Background(), order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder после повторов: %v", err)
+	}
+	if got.OrderUID != order.OrderUID {
+		t.Errorf("получен заказ %s", got.OrderUID)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("ожидалось 3 запроса, сделано %d", n)
+	}
+
+	// Без повторов ошибка 5xx возвращается сразу
+	calls.Store(0)
+	_, err = client.New(ts.URL, client.WithAPIKey(testAdminKey), client.WithRetries(0, 0)).
+		GetOrder(context.Background(), order.OrderUID)
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ожидалась ошибка 503, получено %v", err)
+	}
+}
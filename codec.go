@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// detectFormat определяет формат сообщения по содержимому. NATS Streaming
+// не передает заголовки, поэтому JSON узнается по открывающей фигурной скобке:
+// protobuf-сообщение заказа начинается с тега поля (0x0A для order_uid)
+// и никогда не начинается с '{'.
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return model.FormatJSON
+	}
+	return model.FormatProtobuf
+}
+
+// unmarshalOrder разбирает заказ из JSON или protobuf в зависимости от формата.
+// Для JSON возвращает пути неизвестных полей: в строгом режиме (strict) они
+// приводят к ошибке, в мягком — только попадают в предупреждения.
+// Поля неверного типа отклоняются в обоих режимах.
+func unmarshalOrder(data []byte, format string, strict bool) (*Order, []string, error) {
+	switch format {
+	case model.FormatJSON:
+		return unmarshalJSONOrder(data, strict)
+	case model.FormatProtobuf:
+		pb, err := orderpb.Unmarshal(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка парсинга protobuf: %v", err)
+		}
+		return pb.ToModel(), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("неизвестный формат сообщения %q", format)
+	}
+}
+
+func unmarshalJSONOrder(data []byte, strict bool) (*Order, []string, error) {
+	issues, err := inspectJSON(data, reflect.TypeOf(Order{}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка парсинга JSON: %v", err)
+	}
+	if len(issues.mistyped) > 0 {
+		return nil, nil, fmt.Errorf("неверный тип полей: %s", strings.Join(issues.mistyped, ", "))
+	}
+	if strict && len(issues.unknown) > 0 {
+		return nil, nil, fmt.Errorf("неизвестные поля: %s", strings.Join(issues.unknown, ", "))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	var order Order
+	if err := dec.Decode(&order); err != nil {
+		return nil, nil, fmt.Errorf("ошибка парсинга JSON: %v", err)
+	}
+	return &order, issues.unknown, nil
+}
+
+// jsonIssues — замечания к JSON-заказу: поля, которых нет в Order,
+// и поля, тип значения которых не совпадает с типом в Order
+type jsonIssues struct {
+	unknown  []string
+	mistyped []string
+}
+
+// inspectJSON сверяет JSON-документ со структурой типа t и собирает пути
+// всех неизвестных полей и полей неверного типа (а не только первого, как json.Unmarshal)
+func inspectJSON(data []byte, t reflect.Type) (*jsonIssues, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	issues := &jsonIssues{}
+	issues.walk(doc, t, "")
+	sort.Strings(issues.unknown)
+	sort.Strings(issues.mistyped)
+	return issues, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (ji *jsonIssues) walk(v any, t reflect.Type, path string) {
+	// null допустим для любого поля: json.Unmarshal просто пропускает его
+	if v == nil {
+		return
+	}
+
+	if t == timeType {
+		s, ok := v.(string)
+		if !ok {
+			ji.mistyped = append(ji.mistyped, path)
+			return
+		}
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			ji.mistyped = append(ji.mistyped, path)
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			ji.mistyped = append(ji.mistyped, path)
+			return
+		}
+		for key, value := range obj {
+			field, ok := jsonField(t, key)
+			if !ok {
+				ji.unknown = append(ji.unknown, joinPath(path, key))
+				continue
+			}
+			ji.walk(value, field.Type, joinPath(path, key))
+		}
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			ji.mistyped = append(ji.mistyped, path)
+			return
+		}
+		for i, value := range arr {
+			ji.walk(value, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			ji.mistyped = append(ji.mistyped, path)
+		}
+	case reflect.Int, reflect.Int64:
+		n, ok := v.(json.Number)
+		if !ok {
+			ji.mistyped = append(ji.mistyped, path)
+			return
+		}
+		if _, err := n.Int64(); err != nil {
+			ji.mistyped = append(ji.mistyped, path)
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			ji.mistyped = append(ji.mistyped, path)
+		}
+	}
+}
+
+// jsonField ищет поле структуры по имени JSON-ключа. Как и encoding/json,
+// при отсутствии точного совпадения сравнивает имена без учета регистра.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var fold reflect.StructField
+	found := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f, true
+		}
+		if !found && strings.EqualFold(name, key) {
+			fold, found = f, true
+		}
+	}
+	return fold, found
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// orderJSON возвращает тестовый заказ в JSON, измененный функцией edit
+func orderJSON(t *testing.T, edit func(doc map[string]any)) []byte {
+	t.Helper()
+	data, err := os.ReadFile("model/testdata/order.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	edit(doc)
+	data, err = json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// section возвращает вложенный объект заказа: delivery, payment или первый товар
+func section(doc map[string]any, name string) map[string]any {
+	if name == "items" {
+		return doc["items"].([]any)[0].(map[string]any)
+	}
+	return doc[name].(map[string]any)
+}
+
+func TestUnmarshalJSONOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		edit     func(doc map[string]any)
+		unknown  []string
+		mistyped bool
+	}{
+		{"без изменений", func(map[string]any) {}, nil, false},
+		{"null вместо значения", func(doc map[string]any) { doc["locale"] = nil }, nil, false},
+		{"ключ в другом регистре", func(doc map[string]any) {
+			doc["Track_Number"] = doc["track_number"]
+			delete(doc, "track_number")
+		}, nil, false},
+		{"неизвестное поле заказа", func(doc map[string]any) { doc["extra"] = 1 }, []string{"extra"}, false},
+		{"неизвестные вложенные поля", func(doc map[string]any) {
+			section(doc, "delivery")["floor"] = "3"
+			section(doc, "payment")["tip"] = 10
+			section(doc, "items")["color"] = "red"
+		}, []string{"delivery.floor", "items[0].color", "payment.tip"}, false},
+		{"служебное поле без JSON-имени", func(doc map[string]any) { doc["UpdatedAt"] = "2021-11-26T06:22:19Z" },
+			[]string{"UpdatedAt"}, false},
+		{"строка вместо числа", func(doc map[string]any) { section(doc, "items")["price"] = "453" }, nil, true},
+		{"дробное число вместо целого", func(doc map[string]any) { doc["sm_id"] = 1.5 }, nil, true},
+		{"число вместо строки", func(doc map[string]any) { section(doc, "delivery")["zip"] = 2639809 }, nil, true},
+		{"строка вместо объекта", func(doc map[string]any) { doc["payment"] = "paid" }, nil, true},
+		{"объект вместо массива", func(doc map[string]any) { doc["items"] = map[string]any{} }, nil, true},
+		{"bool вместо числа", func(doc map[string]any) { doc["sm_id"] = true }, nil, true},
+		{"дата не в RFC 3339", func(doc map[string]any) { doc["date_created"] = "26.11.2021" }, nil, true},
+		{"неизвестное поле и неверный тип", func(doc map[string]any) {
+			doc["extra"] = 1
+			doc["sm_id"] = "99"
+		}, []string{"extra"}, true},
+	} {
+		data := orderJSON(t, tc.edit)
+
+		issues, err := inspectJSON(data, reflect.TypeOf(Order{}))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(issues.unknown, tc.unknown) {
+			t.Errorf("%s: неизвестные поля %v, ожидались %v", tc.name, issues.unknown, tc.unknown)
+		}
+		if (len(issues.mistyped) > 0) != tc.mistyped {
+			t.Errorf("%s: поля неверного типа %v", tc.name, issues.mistyped)
+		}
+
+		// Неверный тип отклоняется в обоих режимах, неизвестные поля — только в строгом
+		for _, strict := range []bool{false, true} {
+			order, warnings, err := unmarshalOrder(data, model.FormatJSON, strict)
+			wantErr := tc.mistyped || strict && len(tc.unknown) > 0
+			if (err != nil) != wantErr {
+				t.Errorf("%s, strict=%v: ошибка %v", tc.name, strict, err)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if order.OrderUID == "" {
+				t.Errorf("%s, strict=%v: заказ не разобран", tc.name, strict)
+			}
+			if !reflect.DeepEqual(warnings, tc.unknown) {
+				t.Errorf("%s, strict=%v: предупреждения %v, ожидались %v", tc.name, strict, warnings, tc.unknown)
+			}
+		}
+	}
+}
+
+func TestInspectJSONReportsAllMistypedPaths(t *testing.T) {
+	data := orderJSON(t, func(doc map[string]any) {
+		doc["sm_id"] = "99"
+		section(doc, "payment")["amount"] = "1817"
+		section(doc, "items")["price"] = 4.5
+	})
+	issues, err := inspectJSON(data, reflect.TypeOf(Order{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"items[0].price", "payment.amount", "sm_id"}
+	if !reflect.DeepEqual(issues.mistyped, want) {
+		t.Errorf("поля неверного типа %v, ожидались %v", issues.mistyped, want)
+	}
+
+	if _, err := inspectJSON([]byte(`{"order_uid":`), reflect.TypeOf(Order{})); err == nil {
+		t.Error("обрезанный JSON принят")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	order := testOrder(t)
+	protoPayload, err := orderpb.Marshal(orderpb.FromModel(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"json", []byte(`{"order_uid":"x"}`), model.FormatJSON},
+		{"json с пробелами", []byte("\r\n\t {}"), model.FormatJSON},
+		{"protobuf", protoPayload, model.FormatProtobuf},
+		{"пусто", nil, model.FormatProtobuf},
+	} {
+		if got := detectFormat(tc.data); got != tc.want {
+			t.Errorf("%s: формат %s, ожидался %s", tc.name, got, tc.want)
+		}
+	}
+
+	got, warnings, err := unmarshalOrder(protoPayload, model.FormatProtobuf, true)
+	if err != nil || warnings != nil || got.OrderUID != order.OrderUID {
+		t.Errorf("protobuf: %v, %v, %+v", err, warnings, got)
+	}
+	if _, _, err := unmarshalOrder(protoPayload, "xml", false); err == nil {
+		t.Error("неизвестный формат принят")
+	}
+}
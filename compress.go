@@ -0,0 +1,216 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressSize — ответы короче этого размера отдаются без сжатия
+const minCompressSize = 1024
+
+// compressibleTypes — типы содержимого, которые имеет смысл сжимать
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"text/html",
+	"text/plain",
+}
+
+// withCompression сжимает ответы brotli или gzip в зависимости от
+// Accept-Encoding. Сжатое представление получает собственный ETag с суффиксом
+// кодировки; в If-None-Match суффикс снимается, чтобы обработчик сравнивал
+// теги несжатого представления. Ответ 304 получает суффикс, только если
+// совпавший тег пришел с ним: короткие ответы отдаются без сжатия и с
+// исходным тегом.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		// Upgrade (WebSocket) требует исходного http.Hijacker
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Диапазоны несжатого представления не имеют смысла для сжатого
+		r.Header.Del("Range")
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r.Header.Set("If-None-Match", cw.stripSuffixes(inm))
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding выбирает br или gzip; при равном приоритете предпочитается br
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter накапливает начало ответа, пока не станет ясно, нужно ли
+// его сжимать, и после этого пишет либо через кодировщик, либо напрямую
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	started  bool
+	enc      io.WriteCloser
+	// suffixed — теги из If-None-Match, с которых снят суффикс кодировки
+	suffixed map[string]bool
+}
+
+// stripSuffixes снимает суффикс кодировки с тегов заголовка If-None-Match и
+// запоминает, какие теги его имели
+func (cw *compressWriter) stripSuffixes(inm string) string {
+	suffix := "-" + cw.encoding + `"`
+	tags := strings.Split(inm, ",")
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if stripped, ok := strings.CutSuffix(tag, suffix); ok {
+			tag = stripped + `"`
+			if cw.suffixed == nil {
+				cw.suffixed = make(map[string]bool)
+			}
+			cw.suffixed[tag] = true
+		}
+		tags[i] = tag
+	}
+	return strings.Join(tags, ", ")
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.started {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	if !cw.compressible() {
+		cw.start(false)
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) < minCompressSize {
+		return len(p), nil
+	}
+	cw.start(true)
+	buf := cw.buf
+	cw.buf = nil
+	if _, err := cw.enc.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush отправляет накопленное клиенту; нужен потоковым ответам
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.flushBuffered()
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	for _, t := range compressibleTypes {
+		if strings.EqualFold(strings.TrimSpace(contentType), t) {
+			return true
+		}
+	}
+	return false
+}
+
+// start отправляет заголовки ответа, включая сжатие при необходимости
+func (cw *compressWriter) start(compress bool) {
+	cw.started = true
+	h := cw.Header()
+	etag := h.Get("ETag")
+	notModified := cw.status == http.StatusNotModified && (cw.suffixed[etag] || cw.suffixed["W/"+etag])
+	if strings.HasPrefix(etag, `"`) && (compress || notModified) {
+		h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+cw.encoding+`"`)
+	}
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		switch cw.encoding {
+		case "br":
+			cw.enc = brotli.NewWriterLevel(cw.ResponseWriter, 5)
+		default:
+			cw.enc, _ = gzip.NewWriterLevel(cw.ResponseWriter, gzip.DefaultCompression)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// flushBuffered отправляет короткий ответ, который так и не набрал
+// minCompressSize, без сжатия
+func (cw *compressWriter) flushBuffered() {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.start(false)
+	if len(cw.buf) > 0 {
+		cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+	}
+}
+
+func (cw *compressWriter) close() {
+	switch {
+	case !cw.started && cw.status != 0:
+		cw.flushBuffered()
+	case cw.enc != nil:
+		cw.enc.Close()
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// getOrder запрашивает заказ с заголовками Accept-Encoding и If-None-Match
+func getOrder(t *testing.T, router http.Handler, uid, encoding, inm string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/order/"+uid, nil)
+	r.Header.Set("X-API-Key", testAdminKey)
+	if encoding != "" {
+		r.Header.Set("Accept-Encoding", encoding)
+	}
+	if inm != "" {
+		r.Header.Set("If-None-Match", inm)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestConditionalGetWithCompression(t *testing.T) {
+	small := testOrder(t)
+	small.OrderUID = "small"
+	small.Items = small.Items[:0]
+	large := testOrder(t)
+	large.OrderUID = "large"
+	for len(large.Items) < 10 {
+		large.Items = append(large.Items, large.Items[0])
+	}
+
+	cache := NewOrderCache()
+	cache.Set(small.OrderUID, small)
+	cache.Set(large.OrderUID, large)
+	if entry, _ := cache.Lookup(small.OrderUID); len(entry.JSON) >= minCompressSize {
+		t.Fatalf("малый заказ занимает %d байт, не меньше порога сжатия", len(entry.JSON))
+	}
+	if entry, _ := cache.Lookup(large.OrderUID); len(entry.JSON) < minCompressSize {
+		t.Fatalf("большой заказ занимает %d байт, меньше порога сжатия", len(entry.JSON))
+	}
+	router := newTestServer(t, cache).router
+
+	for _, tc := range []struct {
+		uid, encoding, wantEncoding string
+	}{
+		{"small", "", ""},
+		{"small", "gzip", ""},
+		{"small", "br", ""},
+		{"large", "", ""},
+		{"large", "gzip", "gzip"},
+		{"large", "gzip, br", "br"},
+	} {
+		name := tc.uid + " Accept-Encoding=" + tc.encoding
+		first := getOrder(t, router, tc.uid, tc.encoding, "")
+		if first.Code != http.StatusOK {
+			t.Fatalf("%s: статус %d", name, first.Code)
+		}
+		if got := first.Header().Get("Content-Encoding"); got != tc.wantEncoding {
+			t.Errorf("%s: Content-Encoding %q, ожидался %q", name, got, tc.wantEncoding)
+		}
+		etag := first.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("%s: нет ETag", name)
+		}
+
+		// 304 несет тот же тег, что и закэшированный клиентом ответ 200
+		second := getOrder(t, router, tc.uid, tc.encoding, etag)
+		if second.Code != http.StatusNotModified {
+			t.Errorf("%s: повторный запрос со своим ETag: статус %d", name, second.Code)
+			continue
+		}
+		if got := second.Header().Get("ETag"); got != etag {
+			t.Errorf("%s: ETag ответа 304 %s, ожидался %s", name, got, etag)
+		}
+		if second.Body.Len() != 0 {
+			t.Errorf("%s: у ответа 304 есть тело", name)
+		}
+	}
+
+	// Тег сжатого представления не подходит к несжатому, и наоборот
+	plain := getOrder(t, router, "large", "", "").Header().Get("ETag")
+	gzipped := getOrder(t, router, "large", "gzip", "").Header().Get("ETag")
+	if plain == gzipped {
+		t.Fatalf("у сжатого и несжатого представлений один ETag %s", plain)
+	}
+	if rec := getOrder(t, router, "large", "gzip", `W/`+gzipped); rec.Code != http.StatusNotModified ||
+		rec.Header().Get("ETag") != gzipped {
+		t.Errorf("слабый тег сжатого представления: статус %d, ETag %s", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestCompressedBodyDecodes(t *testing.T) {
+	order := testOrder(t)
+	for len(order.Items) < 10 {
+		order.Items = append(order.Items, order.Items[0])
+	}
+	cache := NewOrderCache()
+	cache.Set(order.OrderUID, order)
+	rec := getOrder(t, newTestServer(t, cache).router, order.OrderUID, "gzip", "")
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("тело не в gzip: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Order
+	if err := json.Unmarshal(data, &got); err != nil || got.OrderUID != order.OrderUID || len(got.Items) != 10 {
+		t.Errorf("распакованный заказ не совпадает: %v, %+v", err, got)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigValidateCacheSync(t *testing.T) {
+	for _, tc := range []struct {
+		mode           string
+		valid          bool
+		postgres, nats bool
+	}{
+		{CacheSyncPostgres, true, true, false},
+		{CacheSyncNATS, true, false, true},
+		{CacheSyncBoth, true, true, true},
+		{CacheSyncOff, true, false, false},
+		{"nast", false, false, false},
+		{"Postgres", false, false, false},
+		{"", false, false, false},
+	} {
+		cfg := Config{CacheSync: tc.mode}
+		err := cfg.Validate()
+		if (err == nil) != tc.valid {
+			t.Errorf("CACHE_SYNC=%q: ошибка %v", tc.mode, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), tc.mode) {
+			t.Errorf("CACHE_SYNC=%q: в ошибке нет значения: %v", tc.mode, err)
+		}
+		if cfg.SyncViaPostgres() != tc.postgres || cfg.SyncViaNATS() != tc.nats {
+			t.Errorf("CACHE_SYNC=%q: postgres=%v, nats=%v", tc.mode, cfg.SyncViaPostgres(), cfg.SyncViaNATS())
+		}
+	}
+}
+
+func TestLoadConfigReplicaIdentity(t *testing.T) {
+	t.Setenv("NATS_CLIENT_ID", "")
+	t.Setenv("NATS_QUEUE_GROUP", "")
+	t.Setenv("NATS_DURABLE_NAME", "")
+	t.Setenv("CACHE_SYNC", "")
+
+	// Реплики с разными INSTANCE_ID получают разные ID клиента NATS
+	t.Setenv("INSTANCE_ID", "orders-7d9f/pod.1")
+	first := LoadConfig()
+	t.Setenv("INSTANCE_ID", "orders-7d9f/pod.2")
+	second := LoadConfig()
+	if first.ClientID != "orders-service-orders-7d9f-pod-1" {
+		t.Errorf("ID клиента %q", first.ClientID)
+	}
+	if first.ClientID == second.ClientID {
+		t.Errorf("у реплик один ID клиента %q", first.ClientID)
+	}
+	if first.QueueGroup != "" || first.DurableName != "orders-service" || first.CacheSync != CacheSyncPostgres {
+		t.Errorf("значения по умолчанию: группа %q, durable %q, синхронизация %q",
+			first.QueueGroup, first.DurableName, first.CacheSync)
+	}
+
+	// Без INSTANCE_ID ID строится из имени хоста и PID и тоже годится для NATS
+	t.Setenv("INSTANCE_ID", "")
+	if cfg := LoadConfig(); cfg.InstanceID == "" || cfg.ClientID != "orders-service-"+sanitizeClientID(cfg.InstanceID) {
+		t.Errorf("ID экземпляра %q, ID клиента %q", cfg.InstanceID, cfg.ClientID)
+	}
+
+	t.Setenv("NATS_CLIENT_ID", "fixed-client")
+	t.Setenv("NATS_QUEUE_GROUP", "orders-workers")
+	t.Setenv("NATS_DURABLE_NAME", "orders-durable")
+	t.Setenv("CACHE_SYNC", CacheSyncBoth)
+	cfg := LoadConfig()
+	if cfg.ClientID != "fixed-client" || cfg.QueueGroup != "orders-workers" ||
+		cfg.DurableName != "orders-durable" || cfg.CacheSync != CacheSyncBoth {
+		t.Errorf("значения из окружения не применены: %+v", cfg)
+	}
+}
+
+func TestSanitizeClientID(t *testing.T) {
+	for in, want := range map[string]string{
+		"host-123":       "host-123",
+		"pod.ns:8080":    "pod-ns-8080",
+		"реплика 1":      "--------1",
+		"Orders_Service": "Orders_Service",
+	} {
+		if got := sanitizeClientID(in); got != want {
+			t.Errorf("%q → %q, ожидалось %q", in, got, want)
+		}
+	}
+}
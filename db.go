@@ -2,23 +2,40 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrOrderNotFound возвращается, когда заказа нет в базе данных
+var ErrOrderNotFound = errors.New("заказ не найден")
+
 type DB struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
+
+	// notifyChannel и instanceID используются для рассылки NOTIFY об изменениях заказов
+	notifyChannel string
+	instanceID    string
+
+	// keyring, если задан, шифрует персональные данные в таблице delivery
+	keyring *Keyring
+
+	// webhooks включает постановку событий в очередь вебхуков при сохранении
+	// заказов; заказы в событиях маскируются webhookRedactor
+	webhooks        bool
+	webhookRedactor *Redactor
 }
 
 func NewDB(dbURL string) (*DB, error) {
-	conn, err := pgx.Connect(context.Background(), dbURL)
+	pool, err := pgxpool.New(context.Background(), dbURL)
 	if err != nil {
 		return nil, fmt.Errorf("не удалось подключиться к базе данных: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{pool: pool}
 	
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("не удалось проверить подключение к базе данных: %w", err)
@@ -29,18 +46,39 @@ func NewDB(dbURL string) (*DB, error) {
 }
 
 func (db *DB) Ping() error {
-	return db.conn.Ping(context.Background())
+	return db.pool.Ping(context.Background())
 }
 
 func (db *DB) Close() error {
-	return db.conn.Close(context.Background())
+	db.pool.Close()
+	return nil
+}
+
+// SetNotify включает рассылку NOTIFY в канал channel при каждом сохранении заказа
+func (db *DB) SetNotify(channel, instanceID string) {
+	db.notifyChannel = channel
+	db.instanceID = instanceID
+}
+
+// SetKeyring включает шифрование персональных данных при сохранении заказов.
+// Расшифровка строк, уже зашифрованных ранее, без набора ключей невозможна.
+func (db *DB) SetKeyring(keyring *Keyring) {
+	db.keyring = keyring
+}
+
+// SetWebhooks включает очередь вебхуков: SaveOrder ставит событие о заказе в
+// очередь в той же транзакции, в которой сохраняет сам заказ. Заказ в событии
+// маскируется redactor.
+func (db *DB) SetWebhooks(redactor *Redactor) {
+	db.webhooks = true
+	db.webhookRedactor = redactor
 }
 
 func (db *DB) SaveOrder(order *Order) error {
     ctx := context.Background()
     
     // Начинаем транзакцию
-    tx, err := db.conn.Begin(ctx)
+    tx, err := db.pool.Begin(ctx)
     if err != nil {
         return fmt.Errorf("ошибка начала транзакции: %w", err)
     }
@@ -48,33 +86,43 @@ func (db *DB) SaveOrder(order *Order) error {
 
     log.Printf("Сохраняем заказ %s...", order.OrderUID)
 
-    _, err = tx.Exec(ctx, `
+    // created — строка вставлена, а не обновлена (у новой строки xmax = 0)
+    var created bool
+    err = tx.QueryRow(ctx, `
         INSERT INTO orders (
             order_uid, track_number, entry, locale, internal_signature,
-            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now())
         ON CONFLICT (order_uid) DO UPDATE SET
             track_number = $2, entry = $3, locale = $4, internal_signature = $5,
             customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9,
-            date_created = $10, oof_shard = $11`,
+            date_created = $10, oof_shard = $11, updated_at = now()
+        RETURNING updated_at, xmax = 0`,
         order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
         order.InternalSignature, order.CustomerID, order.DeliveryService,
-        order.Shardkey, order.SMID, order.DateCreated, order.OOFShard)
+        order.Shardkey, order.SMID, order.DateCreated, order.OOFShard).Scan(&order.UpdatedAt, &created)
     if err != nil {
         return fmt.Errorf("ошибка сохранения заказа: %w", err)
     }
     log.Printf("Основная информация о заказе сохранена")
 
+    delivery, keyID, wrappedDEK, err := db.sealDelivery(order.OrderUID, order.Delivery)
+    if err != nil {
+        return fmt.Errorf("ошибка шифрования информации о доставке: %w", err)
+    }
     _, err = tx.Exec(ctx, `
         INSERT INTO delivery (
-            order_uid, name, phone, zip, city, address, region, email
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            order_uid, name, phone, zip, city, address, region, email,
+            pii_key_id, pii_dek
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
         ON CONFLICT (order_uid) DO UPDATE SET
             name = $2, phone = $3, zip = $4, city = $5,
-            address = $6, region = $7, email = $8`,
-        order.OrderUID, order.Delivery.Name, order.Delivery.Phone,
-        order.Delivery.Zip, order.Delivery.City, order.Delivery.Address,
-        order.Delivery.Region, order.Delivery.Email)
+            address = $6, region = $7, email = $8,
+            pii_key_id = $9, pii_dek = $10`,
+        order.OrderUID, delivery.Name, delivery.Phone,
+        delivery.Zip, delivery.City, delivery.Address,
+        delivery.Region, delivery.Email, keyID, wrappedDEK)
     if err != nil {
         return fmt.Errorf("ошибка сохранения информации о доставке: %w", err)
     }
@@ -83,16 +131,16 @@ func (db *DB) SaveOrder(order *Order) error {
     _, err = tx.Exec(ctx, `
         INSERT INTO payment (
             order_uid, request_id, currency, provider, amount,
-            payment_dt, bank, delivery_cost, goods_total, custom_fee
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            payment_dt, bank, delivery_cost, goods_total, custom_fee, transaction
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         ON CONFLICT (order_uid) DO UPDATE SET
             request_id = $2, currency = $3, provider = $4, amount = $5,
             payment_dt = $6, bank = $7, delivery_cost = $8, goods_total = $9,
-            custom_fee = $10`,
+            custom_fee = $10, transaction = $11`,
         order.OrderUID, order.Payment.RequestID, order.Payment.Currency,
         order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt,
         order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal,
-        order.Payment.CustomFee)
+        order.Payment.CustomFee, order.Payment.Transaction)
     if err != nil {
         return fmt.Errorf("ошибка сохранения информации об оплате: %w", err)
     }
@@ -118,6 +166,20 @@ func (db *DB) SaveOrder(order *Order) error {
     }
     log.Printf("Сохранено %d товаров", len(order.Items))
 
+    // Событие попадает в очередь вебхуков тогда и только тогда, когда
+    // сохранен заказ: после сбоя между сохранением и постановкой в очередь
+    // событие не потеряется
+    if db.webhooks {
+        if err = db.enqueueWebhookEvent(ctx, tx, order, created); err != nil {
+            return err
+        }
+    }
+
+    // Уведомление доставляется слушателям только после фиксации транзакции
+    if err = db.notifyChange(ctx, tx, order.OrderUID); err != nil {
+        return fmt.Errorf("ошибка отправки уведомления об изменении: %w", err)
+    }
+
     // Подтверждаем транзакцию
     if err = tx.Commit(ctx); err != nil {
         return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
@@ -130,64 +192,71 @@ func (db *DB) GetOrder(orderUID string) (*Order, error) {
     ctx := context.Background()
     
     var exists bool
-    err := db.conn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)", orderUID).Scan(&exists)
+    err := db.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)", orderUID).Scan(&exists)
     if err != nil {
         return nil, fmt.Errorf("ошибка проверки существования заказа: %w", err)
     }
     
     if !exists {
         log.Printf("Заказ с ID %s не существует в таблице orders", orderUID)
-        return nil, fmt.Errorf("заказ с ID %s не найден", orderUID)
+        return nil, fmt.Errorf("заказ с ID %s: %w", orderUID, ErrOrderNotFound)
     }
     
     log.Printf("Заказ %s существует в базе, продолжаем загрузку...", orderUID)
 
     orderQuery := `
         SELECT order_uid, track_number, entry, locale, internal_signature,
-            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            updated_at
         FROM orders WHERE order_uid = $1
     `
     
     var order Order
-    err = db.conn.QueryRow(ctx, orderQuery, orderUID).Scan(
+    err = db.pool.QueryRow(ctx, orderQuery, orderUID).Scan(
         &order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
         &order.InternalSignature, &order.CustomerID, &order.DeliveryService,
-        &order.Shardkey, &order.SMID, &order.DateCreated, &order.OOFShard)
+        &order.Shardkey, &order.SMID, &order.DateCreated, &order.OOFShard,
+        &order.UpdatedAt)
     if err != nil {
         return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
     }
 
     var paymentExists bool
-    err = db.conn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM payment WHERE order_uid = $1)", orderUID).Scan(&paymentExists)
+    err = db.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM payment WHERE order_uid = $1)", orderUID).Scan(&paymentExists)
     if err != nil {
         return nil, fmt.Errorf("ошибка проверки payment: %w", err)
     }
     log.Printf("Запись в payment для заказа %s: %v", orderUID, paymentExists)
 
     deliveryQuery := `
-        SELECT name, phone, zip, city, address, region, email
+        SELECT name, phone, zip, city, address, region, email, pii_key_id, pii_dek
         FROM delivery WHERE order_uid = $1
     `
     
-    err = db.conn.QueryRow(ctx, deliveryQuery, orderUID).Scan(
+    var keyID *string
+    var wrappedDEK []byte
+    err = db.pool.QueryRow(ctx, deliveryQuery, orderUID).Scan(
         &order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
         &order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region,
-        &order.Delivery.Email)
+        &order.Delivery.Email, &keyID, &wrappedDEK)
     if err != nil {
         return nil, fmt.Errorf("ошибка при получении информации о доставке: %w", err)
     }
+    if err = db.openDelivery(orderUID, keyID, wrappedDEK, &order.Delivery); err != nil {
+        return nil, err
+    }
 
     paymentQuery := `
         SELECT request_id, currency, provider, amount, payment_dt,
-            bank, delivery_cost, goods_total, custom_fee
+            bank, delivery_cost, goods_total, custom_fee, transaction
         FROM payment WHERE order_uid = $1
     `
     
-    err = db.conn.QueryRow(ctx, paymentQuery, orderUID).Scan(
+    err = db.pool.QueryRow(ctx, paymentQuery, orderUID).Scan(
         &order.Payment.RequestID, &order.Payment.Currency,
         &order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt,
         &order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
-        &order.Payment.CustomFee)
+        &order.Payment.CustomFee, &order.Payment.Transaction)
     if err != nil {
         if err == pgx.ErrNoRows {
             log.Printf("Информация об оплате для заказа %s не найдена, используем пустые значения", orderUID)
@@ -202,7 +271,7 @@ func (db *DB) GetOrder(orderUID string) (*Order, error) {
 		FROM items WHERE order_uid = $1
 	`
 	
-	rows, err := db.conn.Query(ctx, itemsQuery, orderUID)
+	rows, err := db.pool.Query(ctx, itemsQuery, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении товаров: %w", err)
 	}
@@ -229,7 +298,7 @@ func (db *DB) GetAllOrders() ([]*Order, error) {
 	ctx := context.Background()
 	
 	query := "SELECT order_uid FROM orders ORDER BY date_created DESC"
-	rows, err := db.conn.Query(ctx, query)
+	rows, err := db.pool.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка заказов: %w", err)
 	}
@@ -253,3 +322,37 @@ func (db *DB) GetAllOrders() ([]*Order, error) {
 
 	return orders, nil
 }
+
+// sealDelivery шифрует персональные данные доставки, если задан набор ключей.
+// Без ключей данные сохраняются открыто, а keyID и wrappedDEK пусты (NULL).
+func (db *DB) sealDelivery(orderUID string, d Delivery) (Delivery, *string, []byte, error) {
+	if db.keyring == nil {
+		return d, nil, nil, nil
+	}
+	dek, wrapped, err := db.keyring.NewDEK(orderUID)
+	if err != nil {
+		return d, nil, nil, err
+	}
+	sealed, err := encryptDelivery(dek, orderUID, d)
+	if err != nil {
+		return d, nil, nil, err
+	}
+	keyID := db.keyring.Active()
+	return sealed, &keyID, wrapped, nil
+}
+
+// openDelivery расшифровывает персональные данные доставки, прочитанные из БД.
+// Строки без keyID хранятся открыто и не изменяются.
+func (db *DB) openDelivery(orderUID string, keyID *string, wrappedDEK []byte, d *Delivery) error {
+	if keyID == nil {
+		return nil
+	}
+	if db.keyring == nil {
+		return fmt.Errorf("заказ %s: персональные данные зашифрованы ключом %q, а ключи не заданы", orderUID, *keyID)
+	}
+	dek, err := db.keyring.UnwrapDEK(*keyID, orderUID, wrappedDEK)
+	if err != nil {
+		return err
+	}
+	return decryptDelivery(dek, orderUID, d)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// TestSaveOrderKeepsTransaction сохраняет заказ и читает его обратно вместе с
+// payment.transaction. Нужна БД со схемой сервиса в TEST_DATABASE_URL.
+func TestSaveOrderKeepsTransaction(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	db, err := NewDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	order := testOrder(t)
+	order.OrderUID = "transaction-round-trip"
+	order.Payment.Transaction = order.OrderUID
+	defer func() {
+		tx, err := db.pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback(ctx)
+		if err := deleteOrders(ctx, tx, []string{order.OrderUID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := db.SaveOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.GetOrder(order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Payment != order.Payment {
+		t.Errorf("оплата %+v, ожидалась %+v", got.Payment, order.Payment)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Виды записей в хранилище недоставленных сообщений
+const (
+	// DeadLetterRejected — сообщение отклонено и не сохранено
+	DeadLetterRejected = "rejected"
+	// DeadLetterWarning — сообщение принято, но содержит замечания (например, неизвестные поля)
+	DeadLetterWarning = "warning"
+)
+
+// DeadLetter — запись о проблемном сообщении
+type DeadLetter struct {
+	ID         int64     `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Kind       string    `json:"kind"`
+	Source     string    `json:"source"`
+	Reason     string    `json:"reason"`
+	Warnings   []string  `json:"warnings"`
+	Payload    []byte    `json:"payload"`
+}
+
+// SaveDeadLetter сохраняет проблемное сообщение для последующего разбора.
+// Если заданы ключи шифрования, исходные байты сохраняются зашифрованными,
+// как и персональные данные в delivery.
+func (db *DB) SaveDeadLetter(dl *DeadLetter) error {
+	if dl.Warnings == nil {
+		dl.Warnings = []string{}
+	}
+	payload, keyID, wrappedDEK, err := db.sealPayload(dl.Payload)
+	if err != nil {
+		return fmt.Errorf("ошибка шифрования недоставленного сообщения: %w", err)
+	}
+	err = db.pool.QueryRow(context.Background(), `
+		INSERT INTO dead_letters (kind, source, reason, warnings, payload, pii_key_id, pii_dek)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, received_at`,
+		dl.Kind, dl.Source, dl.Reason, dl.Warnings, payload, keyID, wrappedDEK,
+	).Scan(&dl.ID, &dl.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения недоставленного сообщения: %w", err)
+	}
+	return nil
+}
+
+// sealPayload шифрует исходные байты сообщения для записи в БД. Без ключей
+// шифрования возвращает их как есть и keyID = nil.
+func (db *DB) sealPayload(payload []byte) ([]byte, *string, []byte, error) {
+	if db.keyring == nil {
+		return payload, nil, nil, nil
+	}
+	dek, wrapped, err := db.keyring.NewDEK(deadLetterBinding)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sealed, err := encryptPayload(dek, payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyID := db.keyring.Active()
+	return sealed, &keyID, wrapped, nil
+}
+
+// openPayload расшифровывает исходные байты сообщения, прочитанные из БД.
+// Сообщения без keyID хранятся открыто и возвращаются как есть.
+func (db *DB) openPayload(keyID *string, wrappedDEK, payload []byte) ([]byte, error) {
+	if keyID == nil {
+		return payload, nil
+	}
+	if db.keyring == nil {
+		return nil, fmt.Errorf("недоставленное сообщение зашифровано ключом %q, а ключи не заданы", *keyID)
+	}
+	dek, err := db.keyring.UnwrapDEK(*keyID, deadLetterBinding, wrappedDEK)
+	if err != nil {
+		return nil, err
+	}
+	return decryptPayload(dek, payload)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"orders-service/model"
+)
+
+// legacySchemaVersion — версия, которой считаются сообщения без конверта
+const legacySchemaVersion = 1
+
+// message — сообщение после снятия конверта
+type message struct {
+	model.Envelope
+
+	// body — заказ в формате ContentType
+	body []byte
+}
+
+// Upcaster преобразует JSON-заказ версии N в JSON-заказ версии N+1
+type Upcaster func(payload []byte) ([]byte, error)
+
+var upcasters = map[int]Upcaster{}
+
+// RegisterUpcaster регистрирует преобразование заказа из версии fromVersion в fromVersion+1
+func RegisterUpcaster(fromVersion int, up Upcaster) {
+	upcasters[fromVersion] = up
+}
+
+// upcast последовательно поднимает JSON-заказ с версии version до текущей
+func upcast(payload []byte, version int) ([]byte, error) {
+	if version > model.SchemaVersion {
+		return nil, fmt.Errorf("версия схемы %d новее поддерживаемой %d", version, model.SchemaVersion)
+	}
+	for v := version; v < model.SchemaVersion; v++ {
+		up, ok := upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("нет преобразования схемы из версии %d в %d", v, v+1)
+		}
+		var err error
+		if payload, err = up(payload); err != nil {
+			return nil, fmt.Errorf("ошибка преобразования схемы из версии %d: %w", v, err)
+		}
+	}
+	return payload, nil
+}
+
+// openEnvelope снимает конверт с сообщения. Сообщение без конверта (голый
+// JSON-заказ или protobuf) считается заказом версии legacySchemaVersion.
+func openEnvelope(data []byte) (*message, error) {
+	format := detectFormat(data)
+	if format == model.FormatJSON {
+		// Конверт узнается по наличию schema_version и payload на верхнем уровне
+		var probe struct {
+			SchemaVersion *int            `json:"schema_version"`
+			Payload       json.RawMessage `json:"payload"`
+		}
+		if json.Unmarshal(data, &probe) == nil && probe.SchemaVersion != nil && probe.Payload != nil {
+			var msg message
+			if err := json.Unmarshal(data, &msg.Envelope); err != nil {
+				return nil, fmt.Errorf("ошибка разбора конверта: %v", err)
+			}
+			if msg.SchemaVersion < 1 {
+				return nil, fmt.Errorf("некорректная версия схемы %d", msg.SchemaVersion)
+			}
+			return &msg, msg.unwrap()
+		}
+	}
+
+	return &message{
+		Envelope: model.Envelope{
+			SchemaVersion: legacySchemaVersion,
+			ContentType:   format,
+		},
+		body: data,
+	}, nil
+}
+
+// unwrap проверяет поля конверта и извлекает тело заказа
+func (msg *message) unwrap() error {
+	switch msg.EventType {
+	case "", model.EventOrderCreated, model.EventOrderUpdated:
+	default:
+		return fmt.Errorf("неподдерживаемый тип события %q", msg.EventType)
+	}
+
+	switch msg.ContentType {
+	case "", model.FormatJSON:
+		msg.ContentType = model.FormatJSON
+		msg.body = msg.Payload
+	case model.FormatProtobuf:
+		var encoded string
+		if err := json.Unmarshal(msg.Payload, &encoded); err != nil {
+			return fmt.Errorf("protobuf-заказ в payload должен быть строкой base64: %v", err)
+		}
+		body, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("ошибка декодирования base64: %v", err)
+		}
+		msg.body = body
+	default:
+		return fmt.Errorf("неподдерживаемый content_type %q", msg.ContentType)
+	}
+	return nil
+}
+
+// order разбирает заказ из сообщения, при необходимости поднимая версию схемы.
+// Преобразования схемы работают с JSON, поэтому protobuf-заказ старой версии
+// сначала переводится в JSON.
+func (msg *message) order(strict bool) (*Order, []string, error) {
+	body, format := msg.body, msg.ContentType
+	if msg.SchemaVersion == model.SchemaVersion {
+		return unmarshalOrder(body, format, strict)
+	}
+
+	if format == model.FormatProtobuf {
+		order, _, err := unmarshalOrder(body, format, strict)
+		if err != nil {
+			return nil, nil, err
+		}
+		if body, err = json.Marshal(order); err != nil {
+			return nil, nil, err
+		}
+		format = model.FormatJSON
+	}
+
+	body, err := upcast(body, msg.SchemaVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	return unmarshalOrder(body, format, strict)
+}
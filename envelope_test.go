@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// sameOrder сравнивает заказы по их JSON-представлению
+func sameOrder(t *testing.T, got, want *Order) bool {
+	t.Helper()
+	a, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(a, b)
+}
+
+// openOrder снимает конверт с сообщения и разбирает заказ
+func openOrder(data []byte) (*message, *Order, error) {
+	msg, err := openEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, _, err := msg.order(true)
+	return msg, order, err
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	order := testOrder(t)
+	jsonPayload, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoPayload, err := orderpb.Marshal(orderpb.FromModel(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		version int
+		format  string
+	}{
+		{"конверт с JSON", envelopeJSON(t, model.SchemaVersion, model.FormatJSON, jsonPayload), model.SchemaVersion, model.FormatJSON},
+		{"конверт без content_type", envelopeJSON(t, model.SchemaVersion, "", jsonPayload), model.SchemaVersion, model.FormatJSON},
+		{"конверт с protobuf", envelopeJSON(t, model.SchemaVersion, model.FormatProtobuf, protoPayload), model.SchemaVersion, model.FormatProtobuf},
+		{"JSON без конверта", jsonPayload, legacySchemaVersion, model.FormatJSON},
+		{"protobuf без конверта", protoPayload, legacySchemaVersion, model.FormatProtobuf},
+	} {
+		msg, got, err := openOrder(tc.data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if msg.SchemaVersion != tc.version || msg.ContentType != tc.format {
+			t.Errorf("%s: версия %d, формат %s; ожидались %d, %s",
+				tc.name, msg.SchemaVersion, msg.ContentType, tc.version, tc.format)
+		}
+		if !sameOrder(t, got, order) {
+			t.Errorf("%s: заказ изменился: %+v", tc.name, got)
+		}
+	}
+}
+
+func TestUpcastV1Payload(t *testing.T) {
+	v1 := testOrder(t)
+	v1.Payment.Transaction = ""
+	bare, err := json.Marshal(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// В первой версии поля transaction не было вовсе
+	var doc map[string]any
+	if err := json.Unmarshal(bare, &doc); err != nil {
+		t.Fatal(err)
+	}
+	delete(doc["payment"].(map[string]any), "transaction")
+	withoutField, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoPayload, err := orderpb.Marshal(orderpb.FromModel(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"JSON без конверта", withoutField},
+		{"пустой transaction", bare},
+		{"конверт v1 с JSON", envelopeJSON(t, 1, model.FormatJSON, withoutField)},
+		{"конверт v1 с protobuf", envelopeJSON(t, 1, model.FormatProtobuf, protoPayload)},
+		{"protobuf без конверта", protoPayload},
+	} {
+		msg, got, err := openOrder(tc.data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if msg.SchemaVersion != 1 {
+			t.Errorf("%s: версия %d, ожидалась 1", tc.name, msg.SchemaVersion)
+		}
+		if got.Payment.Transaction != v1.OrderUID {
+			t.Errorf("%s: payment.transaction = %q, ожидался order_uid %q",
+				tc.name, got.Payment.Transaction, v1.OrderUID)
+		}
+		want := *v1
+		want.Payment.Transaction = v1.OrderUID
+		if !sameOrder(t, got, &want) {
+			t.Errorf("%s: изменились другие поля: %+v", tc.name, got)
+		}
+	}
+
+	// Заданный производителем transaction не перезаписывается
+	kept := testOrder(t)
+	kept.Payment.Transaction = "tx-from-producer"
+	data, err := json.Marshal(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := openOrder(data); err != nil || got.Payment.Transaction != "tx-from-producer" {
+		t.Errorf("transaction перезаписан: %v, %+v", err, got)
+	}
+	// Заказ без payment получает его с transaction
+	up, err := upcastV1ToV2([]byte(`{"order_uid":"u1","payment":null}`))
+	if err != nil || !bytes.Contains(up, []byte(`"payment":{"transaction":"u1"}`)) {
+		t.Errorf("payment: null: %s, %v", up, err)
+	}
+}
+
+func TestOpenEnvelopeRejects(t *testing.T) {
+	payload, err := json.Marshal(testOrder(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withEvent := func(event string) []byte {
+		var env map[string]any
+		if err := json.Unmarshal(envelopeJSON(t, model.SchemaVersion, model.FormatJSON, payload), &env); err != nil {
+			t.Fatal(err)
+		}
+		env["event_type"] = event
+		data, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"версия новее текущей", envelopeJSON(t, model.SchemaVersion+1, model.FormatJSON, payload)},
+		{"нулевая версия", envelopeJSON(t, 0, model.FormatJSON, payload)},
+		{"неизвестный тип события", withEvent("order.deleted")},
+		{"неизвестный content_type", envelopeJSON(t, model.SchemaVersion, "text/xml", payload)},
+		{"protobuf не строкой", []byte(`{"schema_version":2,"content_type":"application/x-protobuf","payload":{}}`)},
+		{"protobuf не в base64", []byte(`{"schema_version":2,"content_type":"application/x-protobuf","payload":"не base64"}`)},
+	} {
+		if _, _, err := openOrder(tc.data); err == nil {
+			t.Errorf("%s: сообщение принято", tc.name)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// Способы удаления данных покупателя
+const (
+	// ErasureAnonymize стирает персональные данные доставки, сохраняя заказы
+	// для отчетности
+	ErasureAnonymize = "anonymize"
+	// ErasureDelete удаляет заказы покупателя целиком
+	ErasureDelete = "delete"
+)
+
+// erasedCustomerID заменяет customer_id в обезличенных заказах
+const erasedCustomerID = "erased"
+
+var ErrInvalidErasure = errors.New("некорректный запрос на удаление данных")
+
+// ErasureRequest — запрос на удаление данных покупателя
+type ErasureRequest struct {
+	CustomerID string `json:"customer_id"`
+	Mode       string `json:"mode"`
+	Reason     string `json:"reason"`
+	// DryRun только находит затрагиваемые данные, ничего не меняя
+	DryRun bool `json:"dry_run"`
+}
+
+// ErasureReport — итог удаления данных покупателя
+type ErasureReport struct {
+	AuditID     int64     `json:"audit_id,omitempty"`
+	Mode        string    `json:"mode"`
+	DryRun      bool      `json:"dry_run"`
+	Orders      []string  `json:"orders"`
+	DeadLetters int64     `json:"dead_letters"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// EraseCustomer в одной транзакции обезличивает или удаляет все заказы
+// покупателя, удаляет недоставленные сообщения, в которых встречаются его
+// заказы, и записывает аудит. В аудит попадает не сам customer_id, а его хэш.
+func (db *DB) EraseCustomer(ctx context.Context, req ErasureRequest, requestedBy string) (*ErasureReport, error) {
+	if req.CustomerID == "" {
+		return nil, fmt.Errorf("%w: не указан customer_id", ErrInvalidErasure)
+	}
+	if req.Mode != ErasureAnonymize && req.Mode != ErasureDelete {
+		return nil, fmt.Errorf("%w: mode должен быть anonymize или delete", ErrInvalidErasure)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	report := &ErasureReport{
+		Mode:        req.Mode,
+		DryRun:      req.DryRun,
+		Orders:      []string{},
+		RequestedBy: requestedBy,
+		RequestedAt: time.Now().UTC(),
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT order_uid FROM orders WHERE customer_id = $1 ORDER BY order_uid FOR UPDATE`, req.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска заказов покупателя: %w", err)
+	}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения order_uid: %w", err)
+		}
+		report.Orders = append(report.Orders, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка поиска заказов покупателя: %w", err)
+	}
+
+	// Недоставленные сообщения хранят исходный payload, поэтому их нельзя
+	// обезличить по полям: удаляются записи, в которых customer_id покупателя
+	// или order_uid одного из его заказов (см. deadLetterMatches)
+	ids, err := db.matchDeadLetters(ctx, tx, req.CustomerID, report.Orders)
+	if err != nil {
+		return nil, err
+	}
+	report.DeadLetters = int64(len(ids))
+	if !req.DryRun && len(ids) > 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM dead_letters WHERE id = ANY($1)`, ids); err != nil {
+			return nil, fmt.Errorf("ошибка удаления недоставленных сообщений: %w", err)
+		}
+	}
+
+	if req.DryRun {
+		return report, nil
+	}
+
+	switch req.Mode {
+	case ErasureAnonymize:
+		err = anonymizeOrders(ctx, tx, report.Orders)
+	case ErasureDelete:
+		err = deleteOrders(ctx, tx, report.Orders)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Тела событий для вебхуков содержат заказ
+	if _, err := tx.Exec(ctx, `DELETE FROM webhook_deliveries WHERE order_uid = ANY($1)`, report.Orders); err != nil {
+		return nil, fmt.Errorf("ошибка удаления доставок вебхуков: %w", err)
+	}
+
+	for _, uid := range report.Orders {
+		if err := db.notifyChange(ctx, tx, uid); err != nil {
+			return nil, fmt.Errorf("ошибка отправки уведомления об изменении: %w", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(req.CustomerID))
+	err = tx.QueryRow(ctx, `
+		INSERT INTO erasure_audit (requested_by, customer_hash, mode, reason, order_uids, dead_letters)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, requested_at`,
+		requestedBy, hex.EncodeToString(sum[:]), req.Mode, req.Reason, report.Orders, report.DeadLetters,
+	).Scan(&report.AuditID, &report.RequestedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка записи аудита удаления: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return report, nil
+}
+
+// matchDeadLetters возвращает ID недоставленных сообщений покупателя
+// customerID и его заказов orders. Сообщения разбираются в Go: в SQL
+// сравнивать можно только байты, а одно и то же поле записывается
+// по-разному. Зашифрованные сообщения расшифровываются перед проверкой;
+// сообщение, которое не удалось расшифровать, прерывает удаление, чтобы
+// данные покупателя не остались незамеченными.
+func (db *DB) matchDeadLetters(ctx context.Context, tx pgx.Tx, customerID string, orders []string) ([]int64, error) {
+	matches := deadLetterFilter(customerID, orders)
+	rows, err := tx.Query(ctx, `SELECT id, payload, pii_key_id, pii_dek FROM dead_letters ORDER BY id FOR UPDATE`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения недоставленных сообщений: %w", err)
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		var payload, wrappedDEK []byte
+		var keyID *string
+		if err := rows.Scan(&id, &payload, &keyID, &wrappedDEK); err != nil {
+			return nil, fmt.Errorf("ошибка чтения недоставленного сообщения: %w", err)
+		}
+		payload, err := db.openPayload(keyID, wrappedDEK, payload)
+		if err != nil {
+			return nil, fmt.Errorf("недоставленное сообщение %d: %w", id, err)
+		}
+		if matches(payload) {
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения недоставленных сообщений: %w", err)
+	}
+	return ids, nil
+}
+
+// deadLetterFilter возвращает проверку, относится ли сообщение к покупателю
+// customerID или к одному из его заказов orders. Сообщение разбирается так
+// же, как при приеме: конверт (в том числе с protobuf в base64) или голый
+// заказ, JSON с любыми пробелами и экранированием или protobuf. Отклоненное
+// сообщение может не разобраться, поэтому оно проверяется еще и по шаблонам
+// полей в исходных байтах.
+func deadLetterFilter(customerID string, orders []string) func(payload []byte) bool {
+	uids := make(map[string]bool, len(orders))
+	patterns := []fieldPattern{deadLetterPattern("customer_id", protoFieldCustomerID, customerID)}
+	for _, uid := range orders {
+		uids[uid] = true
+		patterns = append(patterns, deadLetterPattern("order_uid", protoFieldOrderUID, uid))
+	}
+	return func(payload []byte) bool {
+		if uid, customer, ok := deadLetterKeys(payload); ok && (customer == customerID || uids[uid]) {
+			return true
+		}
+		for _, p := range patterns {
+			if p.match(payload) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// deadLetterKeys извлекает order_uid и customer_id из сообщения. Остальные
+// поля не разбираются: они могут быть причиной, по которой сообщение
+// отклонено.
+func deadLetterKeys(data []byte) (orderUID, customerID string, ok bool) {
+	msg, err := openEnvelope(data)
+	if err != nil {
+		return "", "", false
+	}
+	if msg.ContentType == model.FormatProtobuf {
+		pb, err := orderpb.Unmarshal(msg.body)
+		if err != nil {
+			return "", "", false
+		}
+		return pb.OrderUid, pb.CustomerId, true
+	}
+	var keys struct {
+		OrderUID   string `json:"order_uid"`
+		CustomerID string `json:"customer_id"`
+	}
+	if json.Unmarshal(msg.body, &keys) != nil {
+		return "", "", false
+	}
+	return keys.OrderUID, keys.CustomerID, true
+}
+
+// Номера полей order_uid и customer_id в сообщении Order (orderpb/order.proto)
+const (
+	protoFieldOrderUID   = 1
+	protoFieldCustomerID = 9
+)
+
+// fieldPattern — представления строкового поля заказа в сообщении, которое
+// не удалось разобрать: JSON "name": "value" с пробелами вокруг двоеточия и
+// protobuf — тег поля, длина и значение. Само значение без имени поля не
+// ищется: короткий order_uid встречается и в чужих сообщениях.
+type fieldPattern struct {
+	json  *regexp.Regexp
+	proto []byte
+}
+
+func (p fieldPattern) match(payload []byte) bool {
+	return p.json.Match(payload) || bytes.Contains(payload, p.proto)
+}
+
+// deadLetterPattern возвращает шаблон поля name (номер field в protobuf) со
+// значением value
+func deadLetterPattern(name string, field uint64, value string) fieldPattern {
+	jsonValue, _ := json.Marshal(value)
+	proto := binary.AppendUvarint(nil, field<<3|2)
+	proto = binary.AppendUvarint(proto, uint64(len(value)))
+	return fieldPattern{
+		json:  regexp.MustCompile(`"` + regexp.QuoteMeta(name) + `"\s*:\s*` + regexp.QuoteMeta(string(jsonValue))),
+		proto: append(proto, value...),
+	}
+}
+
+// anonymizeOrders стирает персональные данные доставки и customer_id.
+// Ключ данных строки удаляется вместе с шифротекстом.
+func anonymizeOrders(ctx context.Context, tx pgx.Tx, uids []string) error {
+	if _, err := tx.Exec(ctx, `
+		UPDATE delivery SET name = '', phone = '', zip = '', address = '', email = '',
+			pii_key_id = NULL, pii_dek = NULL
+		WHERE order_uid = ANY($1)`, uids); err != nil {
+		return fmt.Errorf("ошибка обезличивания доставки: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE orders SET customer_id = $2, updated_at = now() WHERE order_uid = ANY($1)`, uids, erasedCustomerID); err != nil {
+		return fmt.Errorf("ошибка обезличивания заказов: %w", err)
+	}
+	return nil
+}
+
+// deleteOrders удаляет заказы со всеми связанными строками
+func deleteOrders(ctx context.Context, tx pgx.Tx, uids []string) error {
+	for _, table := range []string{"items", "payment", "delivery", "orders"} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE order_uid = ANY($1)", uids); err != nil {
+			return fmt.Errorf("ошибка удаления из %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Eraser выполняет удаление данных покупателя и приводит кэш в соответствие с БД
+type Eraser struct {
+	db      *DB
+	cache   *OrderCache
+	onErase []func(orderUID string)
+}
+
+// NewEraser создает сервис удаления данных
+func NewEraser(db *DB, cache *OrderCache) *Eraser {
+	return &Eraser{db: db, cache: cache}
+}
+
+// OnErase регистрирует функцию, вызываемую для каждого измененного или
+// удаленного заказа (например, анонс другим репликам через NATS)
+func (e *Eraser) OnErase(fn func(orderUID string)) {
+	e.onErase = append(e.onErase, fn)
+}
+
+// Erase удаляет или обезличивает данные покупателя
+func (e *Eraser) Erase(ctx context.Context, req ErasureRequest, requestedBy string) (*ErasureReport, error) {
+	report, err := e.db.EraseCustomer(ctx, req, requestedBy)
+	if err != nil || report.DryRun {
+		return report, err
+	}
+
+	for _, uid := range report.Orders {
+		if req.Mode == ErasureDelete {
+			e.cache.Delete(uid)
+		} else if order, err := e.db.GetOrder(uid); err == nil {
+			e.cache.Set(uid, order)
+		} else {
+			// Лучше не отдать заказ, чем отдать его с персональными данными
+			e.cache.Delete(uid)
+			log.Printf("Не удалось перечитать обезличенный заказ %s: %v", uid, err)
+		}
+		for _, fn := range e.onErase {
+			fn(uid)
+		}
+	}
+	log.Printf("Данные покупателя удалены (%s): заказов %d, недоставленных сообщений %d, аудит #%d",
+		req.Mode, len(report.Orders), report.DeadLetters, report.AuditID)
+	return report, nil
+}
+
+// runErase выполняет команду erase: orders-service erase -customer ID [-mode delete]
+func runErase(db *DB, args []string) error {
+	fs := flag.NewFlagSet("erase", flag.ExitOnError)
+	var req ErasureRequest
+	fs.StringVar(&req.CustomerID, "customer", "", "customer_id покупателя")
+	fs.StringVar(&req.Mode, "mode", ErasureAnonymize, "anonymize — обезличить, delete — удалить заказы")
+	fs.StringVar(&req.Reason, "reason", "", "основание (номер обращения)")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "только показать, что будет удалено")
+	by := fs.String("by", "cli", "кто выполняет удаление (для аудита)")
+	fs.Parse(args)
+
+	// Кэш команды пуст; работающие экземпляры узнают об изменениях через NOTIFY
+	report, err := NewEraser(db, NewOrderCache()).Erase(context.Background(), req, *by)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
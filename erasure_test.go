@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// envelopeJSON заворачивает тело в конверт версии version
+func envelopeJSON(t *testing.T, version int, contentType string, body []byte) []byte {
+	t.Helper()
+	payload := json.RawMessage(body)
+	if contentType == model.FormatProtobuf {
+		payload, _ = json.Marshal(base64.StdEncoding.EncodeToString(body))
+	}
+	data, err := json.MarshalIndent(model.Envelope{
+		SchemaVersion: version,
+		EventType:     model.EventOrderCreated,
+		Producer:      "test",
+		ContentType:   contentType,
+		Payload:       payload,
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDeadLetterFilter(t *testing.T) {
+	order := testOrder(t)
+	order.CustomerID = `José "Q"`
+	compact, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretty, err := json.MarshalIndent(order, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoPayload, err := orderpb.Marshal(orderpb.FromModel(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Тот же customer_id с экранированием é и пробелом после двоеточия
+	escaped := []byte(`{"order_uid": "other-order", "customer_id": "Jos\u00e9 \"Q\"", "items": "не массив"}`)
+	// Сообщение, которое не разбирается как JSON, — только по шаблону поля
+	broken := []byte(`{"order_uid" : "` + order.OrderUID + `", "delivery": {`)
+
+	byCustomer := deadLetterFilter(order.CustomerID, nil)
+	byOrder := deadLetterFilter("someone-else", []string{order.OrderUID})
+	other := deadLetterFilter("someone-else", []string{"other-order-2"})
+
+	for _, tc := range []struct {
+		name       string
+		payload    []byte
+		customer   bool
+		orderMatch bool
+	}{
+		{"json", compact, true, true},
+		{"json с отступами", pretty, true, true},
+		{"protobuf", protoPayload, true, true},
+		{"конверт v2 с JSON", envelopeJSON(t, model.SchemaVersion, model.FormatJSON, compact), true, true},
+		{"конверт v2 с protobuf в base64", envelopeJSON(t, model.SchemaVersion, model.FormatProtobuf, protoPayload), true, true},
+		{"конверт v1", envelopeJSON(t, 1, "", pretty), true, true},
+		{"экранирование", escaped, true, false},
+		{"неразбираемый JSON", broken, false, true},
+	} {
+		if got := byCustomer(tc.payload); got != tc.customer {
+			t.Errorf("%s: совпадение по customer_id = %v, ожидалось %v", tc.name, got, tc.customer)
+		}
+		if got := byOrder(tc.payload); got != tc.orderMatch {
+			t.Errorf("%s: совпадение по order_uid = %v, ожидалось %v", tc.name, got, tc.orderMatch)
+		}
+		if other(tc.payload) {
+			t.Errorf("%s: найдено сообщение чужого покупателя", tc.name)
+		}
+	}
+
+	// Часть order_uid и то же значение в другом поле не совпадают
+	if deadLetterFilter("someone-else", []string{order.OrderUID[:4]})(compact) {
+		t.Error("найден префикс order_uid")
+	}
+	if deadLetterFilter("someone-else", []string{order.TrackNumber})(pretty) {
+		t.Error("track_number принят за order_uid")
+	}
+	if deadLetterFilter(strings.ToUpper(order.CustomerID), nil)(compact) {
+		t.Error("customer_id сравнивается без учета регистра")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics — простой реестр счетчиков, отдаваемых в текстовом формате Prometheus
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]map[string]uint64
+	help     map[string]string
+}
+
+// metrics — реестр счетчиков сервиса
+var metrics = NewMetrics()
+
+// NewMetrics создает пустой реестр счетчиков
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters: make(map[string]map[string]uint64),
+		help:     make(map[string]string),
+	}
+}
+
+// Describe задает описание счетчика для вывода в # HELP
+func (m *Metrics) Describe(name, help string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.help[name] = help
+}
+
+// Inc увеличивает счетчик name с метками labels, заданными парами ключ-значение
+func (m *Metrics) Inc(name string, labels ...string) {
+	key := formatLabels(labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]uint64)
+		m.counters[name] = series
+	}
+	series[key]++
+}
+
+// WriteTo выводит все счетчики в текстовом формате Prometheus
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.counters))
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		if help, ok := m.help[name]; ok {
+			fmt.Fprintf(&sb, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(&sb, "# TYPE %s counter\n", name)
+
+		series := m.counters[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&sb, "%s%s %d\n", name, key, series[key])
+		}
+	}
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// formatLabels превращает пары ключ-значение в {k="v",...}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
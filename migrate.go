@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// migrations — изменения схемы БД, добавленные поверх исходных таблиц
+// orders, delivery, payment и items. Каждая миграция идемпотентна и
+// выполняется при каждом запуске сервиса; новые миграции добавляются в конец.
+var migrations = []string{
+	// Недоставленные сообщения: отклоненные и принятые с предупреждениями
+	`CREATE TABLE IF NOT EXISTS dead_letters (
+		id          BIGSERIAL PRIMARY KEY,
+		received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		kind        TEXT NOT NULL,
+		source      TEXT NOT NULL DEFAULT '',
+		reason      TEXT NOT NULL DEFAULT '',
+		warnings    TEXT[] NOT NULL DEFAULT '{}',
+		payload     BYTEA NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS dead_letters_received_at_idx ON dead_letters (received_at)`,
+	// ID транзакции оплаты (в исходной спецификации совпадает с order_uid)
+	`ALTER TABLE payment ADD COLUMN IF NOT EXISTS transaction TEXT NOT NULL DEFAULT ''`,
+	`UPDATE payment SET transaction = order_uid WHERE transaction = ''`,
+	// Шифрование персональных данных: ID ключа шифрования ключей (KEK) и
+	// зашифрованный им ключ данных строки. NULL — данные хранятся открыто.
+	`ALTER TABLE delivery ADD COLUMN IF NOT EXISTS pii_key_id TEXT`,
+	`ALTER TABLE delivery ADD COLUMN IF NOT EXISTS pii_dek BYTEA`,
+	// Шифротекст в base64 длиннее исходных значений. Тип меняется только один
+	// раз: позже от name зависит столбец полнотекстового поиска.
+	`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'delivery' AND column_name IN ('name', 'phone', 'email', 'address')
+				AND data_type <> 'text') THEN
+			ALTER TABLE delivery
+				ALTER COLUMN name TYPE TEXT,
+				ALTER COLUMN phone TYPE TEXT,
+				ALTER COLUMN email TYPE TEXT,
+				ALTER COLUMN address TYPE TEXT;
+		END IF;
+	END $$`,
+	`CREATE INDEX IF NOT EXISTS delivery_pii_key_id_idx ON delivery (pii_key_id)`,
+	// Аудит удаления данных покупателей; вместо customer_id хранится его SHA-256
+	`CREATE TABLE IF NOT EXISTS erasure_audit (
+		id            BIGSERIAL PRIMARY KEY,
+		requested_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		requested_by  TEXT NOT NULL,
+		customer_hash TEXT NOT NULL,
+		mode          TEXT NOT NULL,
+		reason        TEXT NOT NULL DEFAULT '',
+		order_uids    TEXT[] NOT NULL DEFAULT '{}',
+		dead_letters  BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id)`,
+	// Вебхуки: получатели событий, очередь доставок и журнал попыток
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id               BIGSERIAL PRIMARY KEY,
+		url              TEXT NOT NULL,
+		secret           TEXT NOT NULL,
+		events           TEXT[] NOT NULL DEFAULT '{}',
+		customer_id      TEXT NOT NULL DEFAULT '',
+		delivery_service TEXT NOT NULL DEFAULT '',
+		created_by       TEXT NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id               BIGSERIAL PRIMARY KEY,
+		webhook_id       BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+		event_id         TEXT NOT NULL,
+		event            TEXT NOT NULL,
+		order_uid        TEXT NOT NULL,
+		payload          BYTEA NOT NULL,
+		status           TEXT NOT NULL DEFAULT 'pending',
+		attempts         INT NOT NULL DEFAULT 0,
+		next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_status_code INT NOT NULL DEFAULT 0,
+		last_error       TEXT NOT NULL DEFAULT '',
+		created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+		delivered_at     TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_order_uid_idx ON webhook_deliveries (order_uid)`,
+	`CREATE TABLE IF NOT EXISTS webhook_attempts (
+		id           BIGSERIAL PRIMARY KEY,
+		delivery_id  BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+		attempted_at TIMESTAMPTZ NOT NULL,
+		status_code  INT NOT NULL DEFAULT 0,
+		error        TEXT NOT NULL DEFAULT '',
+		duration_ms  BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_idx ON webhook_attempts (delivery_id)`,
+	// Полнотекстовый поиск. Имя покупателя индексируется, только пока строка
+	// не зашифрована: иначе индекс раскрыл бы персональные данные.
+	`ALTER TABLE delivery ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', CASE WHEN pii_key_id IS NULL THEN coalesce(name, '') ELSE '' END), 'A') ||
+		setweight(to_tsvector('english', CASE WHEN pii_key_id IS NULL THEN coalesce(name, '') ELSE '' END), 'A') ||
+		setweight(to_tsvector('russian', coalesce(city, '') || ' ' || coalesce(region, '')), 'C') ||
+		setweight(to_tsvector('english', coalesce(city, '') || ' ' || coalesce(region, '')), 'C')
+	) STORED`,
+	`CREATE INDEX IF NOT EXISTS delivery_search_idx ON delivery USING GIN (search)`,
+	`ALTER TABLE items ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(brand, '') || ' ' || coalesce(name, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(brand, '') || ' ' || coalesce(name, '')), 'B')
+	) STORED`,
+	`CREATE INDEX IF NOT EXISTS items_search_idx ON items USING GIN (search)`,
+	// Статистика выбирает заказы по дате создания
+	`CREATE INDEX IF NOT EXISTS orders_date_created_idx ON orders (date_created)`,
+	`CREATE INDEX IF NOT EXISTS items_order_uid_idx ON items (order_uid)`,
+	// Момент последнего изменения заказа — основа Last-Modified, одинаковая
+	// на всех экземплярах и после перезапуска. Для старых заказов — date_created.
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'orders' AND column_name = 'updated_at') THEN
+			ALTER TABLE orders ADD COLUMN updated_at TIMESTAMPTZ;
+			UPDATE orders SET updated_at = date_created;
+			ALTER TABLE orders ALTER COLUMN updated_at SET DEFAULT now();
+			ALTER TABLE orders ALTER COLUMN updated_at SET NOT NULL;
+		END IF;
+	END $$`,
+	// Поиск без права на персональные данные проверяет совпадения по полям,
+	// которые не маскирует PII_MASK_FIELDS, во время запроса, а кандидатов
+	// отбирает по индексу search. Отдельный столбец с городом и регионом не
+	// нужен.
+	`DROP INDEX IF EXISTS delivery_search_public_idx`,
+	`ALTER TABLE delivery DROP COLUMN IF EXISTS search_public`,
+	// Недоставленные сообщения содержат те же персональные данные, что и
+	// delivery, и шифруются тем же набором ключей
+	`ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS pii_key_id TEXT`,
+	`ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS pii_dek BYTEA`,
+}
+
+// Migrate применяет миграции схемы БД
+func (db *DB) Migrate() error {
+	ctx := context.Background()
+	for i, stmt := range migrations {
+		if _, err := db.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("ошибка миграции %d: %w", i+1, err)
+		}
+	}
+	log.Printf("Миграции схемы БД применены: %d", len(migrations))
+	return nil
+}
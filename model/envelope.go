@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SchemaVersion — текущая версия схемы заказа.
+//
+// История версий:
+//   - 1 — исходный формат без payment.transaction;
+//   - 2 — добавлен payment.transaction.
+const SchemaVersion = 2
+
+// Типы событий, которые может нести конверт
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// Форматы заказа внутри сообщения
+const (
+	FormatJSON     = "application/json"
+	FormatProtobuf = "application/x-protobuf"
+)
+
+// Envelope — необязательный конверт сообщения с метаданными и заказом внутри.
+// JSON-заказ передается в payload как объект, protobuf-заказ — как строка base64.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventType     string          `json:"event_type"`
+	ProducedAt    time.Time       `json:"produced_at"`
+	Producer      string          `json:"producer"`
+	ContentType   string          `json:"content_type,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
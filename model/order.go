@@ -0,0 +1,93 @@
+// Package model содержит типы заказа, общие для сервиса, publisher и клиентов API.
+//
+// JSON-теги определяют формат сообщений в NATS Streaming и ответов HTTP API,
+// поэтому менять их можно только вместе с версией схемы (SchemaVersion).
+package model
+
+import (
+	"time"
+)
+
+type Order struct {
+	OrderUID          string    `json:"order_uid"`
+	TrackNumber       string    `json:"track_number"`
+	Entry             string    `json:"entry"`
+	Delivery          Delivery  `json:"delivery"`
+	Payment           Payment   `json:"payment"`
+	Items             []Item    `json:"items"`
+	Locale            string    `json:"locale"`
+	InternalSignature string    `json:"internal_signature"`
+	CustomerID        string    `json:"customer_id"`
+	DeliveryService   string    `json:"delivery_service"`
+	Shardkey          string    `json:"shardkey"`
+	SMID              int       `json:"sm_id"`
+	DateCreated       time.Time `json:"date_created"`
+	OOFShard          string    `json:"oof_shard"`
+
+	// UpdatedAt — момент последнего сохранения заказа в БД. Заполняется
+	// хранилищем и не входит ни в сообщения, ни в ответы API.
+	UpdatedAt time.Time `json:"-"`
+}
+
+type Delivery struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+type Payment struct {
+	Transaction  string `json:"transaction"`
+	RequestID    string `json:"request_id"`
+	Currency     string `json:"currency"`
+	Provider     string `json:"provider"`
+	Amount       int    `json:"amount"`
+	PaymentDt    int64  `json:"payment_dt"`
+	Bank         string `json:"bank"`
+	DeliveryCost int    `json:"delivery_cost"`
+	GoodsTotal   int    `json:"goods_total"`
+	CustomFee    int    `json:"custom_fee"`
+}
+
+type Item struct {
+	ChrtID      int    `json:"chrt_id"`
+	TrackNumber string `json:"track_number"`
+	Price       int    `json:"price"`
+	RID         string `json:"rid"`
+	Name        string `json:"name"`
+	Sale        int    `json:"sale"`
+	Size        string `json:"size"`
+	TotalPrice  int    `json:"total_price"`
+	NMID        int    `json:"nm_id"`
+	Brand       string `json:"brand"`
+	Status      int    `json:"status"`
+}
+
+// NewOrder создает заказ с согласованными идентификаторами: ID транзакции
+// оплаты совпадает с orderUID, дата создания — текущее время
+func NewOrder(orderUID, trackNumber, customerID string) *Order {
+	return &Order{
+		OrderUID:    orderUID,
+		TrackNumber: trackNumber,
+		CustomerID:  customerID,
+		Payment: Payment{
+			Transaction: orderUID,
+		},
+		DateCreated: time.Now().UTC(),
+	}
+}
+
+// AddItem добавляет товар с трек-номером заказа и пересчитывает сумму товаров
+func (o *Order) AddItem(item Item) {
+	item.TrackNumber = o.TrackNumber
+	o.Items = append(o.Items, item)
+
+	o.Payment.GoodsTotal = 0
+	for _, it := range o.Items {
+		o.Payment.GoodsTotal += it.TotalPrice
+	}
+	o.Payment.Amount = o.Payment.GoodsTotal + o.Payment.DeliveryCost + o.Payment.CustomFee
+}
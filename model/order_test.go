@@ -0,0 +1,103 @@
+package model_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// fixture читает тестовый заказ из задания
+func fixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/order.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestOrderJSONRoundTrip(t *testing.T) {
+	data := fixture(t)
+
+	var order model.Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		t.Fatalf("разбор заказа: %v", err)
+	}
+	if err := order.Validate(); err != nil {
+		t.Fatalf("тестовый заказ не прошел проверку: %v", err)
+	}
+	encoded, err := json.Marshal(&order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Сравниваются документы, а не байты: порядок ключей и отступы не важны
+	var want, got map[string]any
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("JSON после круга не совпадает:\nwant %v\ngot  %v", want, got)
+	}
+}
+
+func TestOrderProtobufRoundTrip(t *testing.T) {
+	var order model.Order
+	if err := json.Unmarshal(fixture(t), &order); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := orderpb.Marshal(orderpb.FromModel(&order))
+	if err != nil {
+		t.Fatalf("сериализация в protobuf: %v", err)
+	}
+	pb, err := orderpb.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("разбор protobuf: %v", err)
+	}
+	got := pb.ToModel()
+
+	if !got.DateCreated.Equal(order.DateCreated) {
+		t.Errorf("date_created: want %v, got %v", order.DateCreated, got.DateCreated)
+	}
+	got.DateCreated = order.DateCreated
+	if !reflect.DeepEqual(&order, got) {
+		t.Errorf("заказ после круга через protobuf не совпадает:\nwant %+v\ngot  %+v", order, *got)
+	}
+}
+
+func TestValidatePaymentTransaction(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		orderUID    string
+		transaction string
+		valid       bool
+	}{
+		{"совпадает с order_uid", "b563feb7b2b84b6test", "b563feb7b2b84b6test", true},
+		{"другая транзакция", "b563feb7b2b84b6test", "b563feb7b2b84b6other", false},
+		{"пустая транзакция", "b563feb7b2b84b6test", "", false},
+		{"другой регистр", "b563feb7b2b84b6test", "B563FEB7B2B84B6TEST", false},
+		{"нет order_uid", "", "", false},
+	} {
+		var order model.Order
+		if err := json.Unmarshal(fixture(t), &order); err != nil {
+			t.Fatal(err)
+		}
+		order.OrderUID, order.Payment.Transaction = tc.orderUID, tc.transaction
+		err := order.Validate()
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: ошибка %v", tc.name, err)
+		}
+		if err != nil && !errors.Is(err, model.ErrInvalidOrder) {
+			t.Errorf("%s: ошибка не оборачивает ErrInvalidOrder: %v", tc.name, err)
+		}
+	}
+}
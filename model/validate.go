@@ -0,0 +1,25 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidOrder оборачивает ошибки разбора и валидации заказа
+var ErrInvalidOrder = errors.New("некорректный заказ")
+
+// Validate проверяет бизнес-правила заказа
+func (o *Order) Validate() error {
+	// Валидация: проверяем обязательные поля
+	if o.OrderUID == "" {
+		return fmt.Errorf("%w: отсутствует order_uid", ErrInvalidOrder)
+	}
+
+	// По исходной спецификации ID транзакции оплаты совпадает с order_uid
+	if o.Payment.Transaction != o.OrderUID {
+		return fmt.Errorf("%w: payment.transaction %q не совпадает с order_uid %q",
+			ErrInvalidOrder, o.Payment.Transaction, o.OrderUID)
+	}
+
+	return nil
+}
@@ -2,99 +2,350 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/stan.go"
 )
 
+// Состояния подключения к NATS Streaming
+const (
+	NATSConnected    = "connected"
+	NATSReconnecting = "reconnecting"
+	NATSClosed       = "closed"
+)
+
 // NATSClient представляет клиент NATS Streaming
 type NATSClient struct {
-	conn  stan.Conn
-	sub   stan.Subscription
-	db    *DB
-	cache *OrderCache
-}
-
-// NewNATSClient создает новое подключение к NATS Streaming
-func NewNATSClient(clusterID, clientID, natsURL string, db *DB, cache *OrderCache) (*NATSClient, error) {
-	// Подключаемся к NATS Streaming
-	conn, err := stan.Connect(
-		clusterID,
-		clientID,
-		stan.NatsURL(natsURL),
+	mu        sync.RWMutex
+	conn      stan.Conn
+	sub       stan.Subscription
+	processor *OrderProcessor
+
+	clusterID    string
+	clientID     string
+	natsURL      string
+	pingInterval int
+	pingMaxOut   int
+
+	// Параметры подписки запоминаются, чтобы восстановить её после переподключения
+	channel     string
+	queueGroup  string
+	durableName string
+
+	// replayChannel — канал заказов, который проигрывает Replay
+	replayChannel string
+
+	// Широковещательный канал для синхронизации кэшей между репликами
+	broadcastChannel string
+	broadcastSub     stan.Subscription
+	instanceID       string
+	cacheSync        *CacheSync
+
+	// dial подключается к NATS Streaming; тесты подменяют его
+	dial func() (stan.Conn, error)
+
+	state     atomic.Value
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// natsReconnectDelay — первая задержка перед переподключением; затем она
+// удваивается до 30 секунд
+var natsReconnectDelay = time.Second
+
+// NewNATSClient создает новое подключение к NATS Streaming.
+// При потере соединения клиент сам переподключается и восстанавливает подписки.
+func NewNATSClient(cfg Config, processor *OrderProcessor) (*NATSClient, error) {
+	nc := &NATSClient{
+		processor:     processor,
+		clusterID:     cfg.ClusterID,
+		clientID:      cfg.ClientID,
+		natsURL:       cfg.NATSURL,
+		pingInterval:  cfg.NATSPingInterval,
+		pingMaxOut:    cfg.NATSPingMaxOut,
+		replayChannel: cfg.Channel,
+		closed:        make(chan struct{}),
+	}
+	nc.dial = nc.dialStan
+	nc.state.Store(NATSReconnecting)
+
+	// Пробуем подключиться несколько раз
+	var err error
+	for i := 0; i < 3; i++ {
+		if err = nc.connect(); err == nil {
+			break
+		}
+		log.Printf("NATS: попытка %d неудачна: %v", i+1, err)
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	nc.state.Store(NATSConnected)
+
+	log.Println("Подключение к NATS Streaming успешно!")
+	return nc, nil
+}
+
+// connect устанавливает соединение. Состояние NATSConnected выставляет
+// вызывающий, когда подписки восстановлены.
+func (nc *NATSClient) connect() error {
+	conn, err := nc.dial()
+	if err != nil {
+		return err
+	}
+
+	nc.mu.Lock()
+	nc.conn = conn
+	nc.mu.Unlock()
+	return nil
+}
+
+// dialStan подключается к NATS Streaming. Пинги позволяют серверу и клиенту
+// быстро заметить обрыв: после pingMaxOut пропущенных ответов соединение
+// считается потерянным.
+func (nc *NATSClient) dialStan() (stan.Conn, error) {
+	return stan.Connect(
+		nc.clusterID,
+		nc.clientID,
+		stan.NatsURL(nc.natsURL),
+		stan.Pings(nc.pingInterval, nc.pingMaxOut),
 		stan.SetConnectionLostHandler(func(_ stan.Conn, reason error) {
 			log.Printf("Соединение с NATS потеряно: %v", reason)
+			go nc.reconnect()
 		}),
 	)
-	if err != nil {
-		return nil, err
+}
+
+// reconnect переподключается с экспоненциальной задержкой и восстанавливает
+// подписки. Клиент считается подключенным, только когда подписки восстановлены.
+func (nc *NATSClient) reconnect() {
+	nc.state.Store(NATSReconnecting)
+
+	backoff := natsReconnectDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-nc.closed:
+			return
+		case <-time.After(backoff):
+		}
+
+		if err := nc.connect(); err != nil {
+			log.Printf("NATS: попытка переподключения %d неудачна: %v", attempt, err)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+
+		if err := nc.resubscribe(); err != nil {
+			log.Printf("NATS: не удалось восстановить подписки: %v", err)
+			nc.mu.RLock()
+			nc.conn.Close()
+			nc.mu.RUnlock()
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+
+		select {
+		case <-nc.closed:
+			// Close вызван во время переподключения: новое соединение не нужно
+			nc.mu.RLock()
+			nc.conn.Close()
+			nc.mu.RUnlock()
+			return
+		default:
+		}
+		nc.state.Store(NATSConnected)
+		log.Printf("NATS: соединение восстановлено после %d попыток", attempt)
+		return
 	}
+}
 
-	log.Println("Подключение к NATS Streaming успешно!")
+// resubscribe заново создает подписки, существовавшие до обрыва соединения.
+// Durable-подписка продолжит с последнего подтвержденного сообщения.
+func (nc *NATSClient) resubscribe() error {
+	nc.mu.RLock()
+	channel, queueGroup, durableName := nc.channel, nc.queueGroup, nc.durableName
+	broadcastChannel, instanceID, cacheSync := nc.broadcastChannel, nc.instanceID, nc.cacheSync
+	nc.mu.RUnlock()
 
-	return &NATSClient{
-		conn:  conn,
-		db:    db,
-		cache: cache,
-	}, nil
+	if channel != "" {
+		if err := nc.Subscribe(channel, queueGroup, durableName); err != nil {
+			return err
+		}
+	}
+	if broadcastChannel != "" && cacheSync != nil {
+		if err := nc.SubscribeBroadcast(broadcastChannel, instanceID, cacheSync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// State возвращает текущее состояние подключения
+func (nc *NATSClient) State() string {
+	return nc.state.Load().(string)
+}
+
+// HealthCheck возвращает ошибку, если соединение с NATS сейчас не установлено
+func (nc *NATSClient) HealthCheck() error {
+	if state := nc.State(); state != NATSConnected {
+		return fmt.Errorf("NATS: %s", state)
+	}
+	return nil
 }
 
-// Subscribe подписывается на канал и обрабатывает сообщения
-func (nc *NATSClient) Subscribe(channel string) error {
-	// Подписываемся на канал с опциями
-	sub, err := nc.conn.Subscribe(channel, nc.handleMessage,
+// Subscribe подписывается на канал и обрабатывает сообщения.
+// Если задана queueGroup, используется durable-подписка группы очереди:
+// реплики с одинаковой группой делят сообщения канала между собой.
+func (nc *NATSClient) Subscribe(channel, queueGroup, durableName string) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.channel, nc.queueGroup, nc.durableName = channel, queueGroup, durableName
+
+	opts := []stan.SubscriptionOption{
 		stan.SetManualAckMode(),
-		stan.DurableName("orders-service"), 
+		stan.DurableName(durableName),
 		stan.StartWithLastReceived(),
-	)
+	}
+
+	var sub stan.Subscription
+	var err error
+	if queueGroup != "" {
+		sub, err = nc.conn.QueueSubscribe(channel, queueGroup, nc.handleMessage, opts...)
+	} else {
+		sub, err = nc.conn.Subscribe(channel, nc.handleMessage, opts...)
+	}
 	if err != nil {
 		return err
 	}
 
 	nc.sub = sub
-	log.Printf("Подписка на канал '%s' успешна!", channel)
+	if queueGroup != "" {
+		log.Printf("Подписка на канал '%s' в группе '%s' успешна!", channel, queueGroup)
+	} else {
+		log.Printf("Подписка на канал '%s' успешна!", channel)
+	}
 	return nil
 }
 
-// handleMessage обрабатывает полученное сообщение
-func (nc *NATSClient) handleMessage(msg *stan.Msg) {
-	log.Printf("Получено сообщение из NATS (Sequence: %d)", msg.Sequence)
+// SubscribeBroadcast подписывает реплику на широковещательный канал обновлений кэша.
+// После этого каждый обработанный заказ анонсируется в канал, а анонсы других
+// реплик приводят к обновлению заказа в локальном кэше.
+func (nc *NATSClient) SubscribeBroadcast(channel, instanceID string, cacheSync *CacheSync) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.broadcastChannel = channel
+	nc.instanceID = instanceID
+	nc.cacheSync = cacheSync
+
+	// Подписка не durable и без группы: каждая реплика получает все анонсы,
+	// но только те, что опубликованы после её запуска
+	sub, err := nc.conn.Subscribe(channel, nc.handleBroadcast)
+	if err != nil {
+		return err
+	}
+
+	if nc.broadcastSub == nil {
+		nc.processor.OnStored(func(event OrderEvent) { nc.announce(event.Order.OrderUID) })
+	}
+	nc.broadcastSub = sub
+	log.Printf("Подписка на канал обновлений кэша '%s' успешна!", channel)
+	return nil
+}
 
-	// Валидация: проверяем, что это валидный JSON
-	var order Order
-	if err := json.Unmarshal(msg.Data, &order); err != nil {
-		log.Printf("Ошибка парсинга JSON: %v. Данные: %s", err, string(msg.Data))
-		msg.Ack()
+// AnnounceTo публикует ID сохраненных заказов в широковещательный канал без
+// подписки на него: так команда replay сообщает о заказах работающим репликам
+func (nc *NATSClient) AnnounceTo(channel, instanceID string) {
+	nc.mu.Lock()
+	nc.broadcastChannel = channel
+	nc.instanceID = instanceID
+	nc.mu.Unlock()
+	nc.processor.OnStored(func(event OrderEvent) { nc.announce(event.Order.OrderUID) })
+}
+
+// handleBroadcast обрабатывает анонс изменения заказа от другой реплики
+func (nc *NATSClient) handleBroadcast(msg *stan.Msg) {
+	nc.mu.RLock()
+	channel, instanceID, cacheSync := nc.broadcastChannel, nc.instanceID, nc.cacheSync
+	nc.mu.RUnlock()
+
+	var change OrderChange
+	if err := json.Unmarshal(msg.Data, &change); err != nil {
+		log.Printf("Некорректный анонс в канале %s: %v", channel, err)
 		return
 	}
+	if change.Source == instanceID {
+		return
+	}
+	cacheSync.Refresh(change.OrderUID)
+}
 
-	// Валидация: проверяем обязательные поля
-	if order.OrderUID == "" {
-		log.Printf("Ошибка валидации: отсутствует order_uid. Данные: %s", string(msg.Data))
-		msg.Ack()
+// announce публикует в широковещательный канал ID сохраненного заказа
+func (nc *NATSClient) announce(orderUID string) {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	if nc.broadcastChannel == "" {
 		return
 	}
 
-	// Сохраняем в базу данных
-	if err := nc.db.SaveOrder(&order); err != nil {
-		log.Printf("Ошибка сохранения заказа в БД: %v", err)
-		// НЕ подтверждаем сообщение, чтобы попробовать обработать его снова
+	data, err := json.Marshal(OrderChange{OrderUID: orderUID, Source: nc.instanceID})
+	if err != nil {
+		log.Printf("Ошибка сериализации анонса: %v", err)
 		return
 	}
+	if err := nc.conn.Publish(nc.broadcastChannel, data); err != nil {
+		log.Printf("Ошибка публикации анонса заказа %s: %v", orderUID, err)
+	}
+}
 
-	// Сохраняем в кэш
-	nc.cache.Set(order.OrderUID, &order)
-	log.Printf("Заказ %s успешно обработан и сохранен", order.OrderUID)
+// handleMessage обрабатывает полученное сообщение
+func (nc *NATSClient) handleMessage(msg *stan.Msg) {
+	log.Printf("Получено сообщение из NATS (Sequence: %d)", msg.Sequence)
+
+	source := fmt.Sprintf("nats:%s#%d", msg.Subject, msg.Sequence)
+	outcome, order, err := nc.processor.Process(msg.Data, source, false)
+	logOutcome(outcome, order, err, msg.Data)
+	if outcome == "" {
+		// НЕ подтверждаем сообщение, чтобы попробовать обработать его снова
+		return
+	}
 
 	// Подтверждаем обработку сообщения
 	msg.Ack()
 }
 
-// Close закрывает подключение к NATS Streaming
+// Close закрывает подключение к NATS Streaming. Повторные вызовы ничего не делают.
 func (nc *NATSClient) Close() error {
+	var err error
+	nc.closeOnce.Do(func() { err = nc.close() })
+	return err
+}
+
+func (nc *NATSClient) close() error {
+	close(nc.closed)
+	nc.state.Store(NATSClosed)
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	// Подписка на анонсы не durable, её состояние на сервере не нужно
+	if nc.broadcastSub != nil {
+		if err := nc.broadcastSub.Unsubscribe(); err != nil {
+			log.Printf("Ошибка при закрытии подписки на анонсы: %v", err)
+		}
+	}
+
+	// Close, а не Unsubscribe: durable-подписка (и группа очереди) должна
+	// сохраниться на сервере, чтобы реплика продолжила с того же места
 	if nc.sub != nil {
-		if err := nc.sub.Unsubscribe(); err != nil {
+		if err := nc.sub.Close(); err != nil {
 			log.Printf("Ошибка при отписке: %v", err)
 		}
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// fakeStanConn — соединение NATS Streaming без сервера. Подписка вызывает
+// onSubscribe, который может вернуть ошибку, и запоминается в subs.
+type fakeStanConn struct {
+	stan.Conn
+	onSubscribe func() error
+	mu          sync.Mutex
+	closed      bool
+	subs        []fakeSubscription
+}
+
+// fakeSubscription — параметры подписки на fakeStanConn
+type fakeSubscription struct {
+	subject, queueGroup string
+	opts                stan.SubscriptionOptions
+}
+
+func (c *fakeStanConn) Subscribe(subject string, cb stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	return c.QueueSubscribe(subject, "", cb, opts...)
+}
+
+func (c *fakeStanConn) QueueSubscribe(subject, queueGroup string, _ stan.MsgHandler, opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	if c.onSubscribe != nil {
+		if err := c.onSubscribe(); err != nil {
+			return nil, err
+		}
+	}
+	sub := fakeSubscription{subject: subject, queueGroup: queueGroup}
+	for _, opt := range opts {
+		if err := opt(&sub.opts); err != nil {
+			return nil, err
+		}
+	}
+	c.subs = append(c.subs, sub)
+	return fakeStanSub{}, nil
+}
+
+func (c *fakeStanConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+type fakeStanSub struct{ stan.Subscription }
+
+func (fakeStanSub) Close() error       { return nil }
+func (fakeStanSub) Unsubscribe() error { return nil }
+
+func TestNATSReconnectStateFollowsResubscribe(t *testing.T) {
+	defer func(d time.Duration) { natsReconnectDelay = d }(natsReconnectDelay)
+	natsReconnectDelay = time.Millisecond
+
+	nc := &NATSClient{closed: make(chan struct{}), channel: "orders", durableName: "orders-service"}
+	nc.state.Store(NATSConnected)
+
+	// Первое новое соединение не может восстановить подписку, второе — может.
+	// Пока подписка не восстановлена, клиент не считается подключенным.
+	var conns []*fakeStanConn
+	var states []string
+	nc.dial = func() (stan.Conn, error) {
+		conn := &fakeStanConn{onSubscribe: func() error {
+			states = append(states, nc.State())
+			if len(states) == 1 {
+				return errors.New("подписка не создана")
+			}
+			return nil
+		}}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+
+	nc.reconnect()
+	if len(states) != 2 || states[0] != NATSReconnecting || states[1] != NATSReconnecting {
+		t.Errorf("состояние во время восстановления подписок: %v", states)
+	}
+	if nc.State() != NATSConnected || nc.HealthCheck() != nil {
+		t.Errorf("после восстановления подписок: %s", nc.State())
+	}
+	if len(conns) != 2 || !conns[0].closed || conns[1].closed {
+		t.Errorf("закрыто не то соединение: %d соединений", len(conns))
+	}
+
+	if err := nc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Close(); err != nil {
+		t.Errorf("повторный Close: %v", err)
+	}
+	if nc.State() != NATSClosed || !conns[1].closed {
+		t.Errorf("после Close: %s", nc.State())
+	}
+}
+
+func TestNATSReconnectStopsAfterClose(t *testing.T) {
+	defer func(d time.Duration) { natsReconnectDelay = d }(natsReconnectDelay)
+	natsReconnectDelay = time.Millisecond
+
+	nc := &NATSClient{closed: make(chan struct{}), channel: "orders"}
+	var conn *fakeStanConn
+	closed := make(chan struct{})
+	nc.dial = func() (stan.Conn, error) {
+		conn = &fakeStanConn{onSubscribe: func() error {
+			// Сервис останавливается, пока подписки восстанавливаются
+			go func() {
+				nc.Close()
+				close(closed)
+			}()
+			for nc.State() != NATSClosed {
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		}}
+		return conn, nil
+	}
+
+	nc.reconnect()
+	<-closed
+	if nc.State() != NATSClosed || !conn.closed {
+		t.Errorf("после Close во время переподключения: состояние %s, соединение закрыто: %v", nc.State(), conn.closed)
+	}
+}
+
+func TestNATSSubscribeQueueGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name, queueGroup string
+	}{
+		{"без группы", ""},
+		{"группа очереди", "orders-workers"},
+	} {
+		conn := &fakeStanConn{}
+		nc := &NATSClient{conn: conn, closed: make(chan struct{})}
+		if err := nc.Subscribe("orders", tc.queueGroup, "orders-service"); err != nil {
+			t.Fatal(err)
+		}
+		if len(conn.subs) != 1 {
+			t.Fatalf("%s: %d подписок", tc.name, len(conn.subs))
+		}
+		sub := conn.subs[0]
+		if sub.subject != "orders" || sub.queueGroup != tc.queueGroup {
+			t.Errorf("%s: подписка на %q в группе %q", tc.name, sub.subject, sub.queueGroup)
+		}
+		// Реплики группы делят одну durable-подписку и подтверждают сообщения сами
+		if sub.opts.DurableName != "orders-service" || !sub.opts.ManualAcks {
+			t.Errorf("%s: durable %q, ручное подтверждение %v", tc.name, sub.opts.DurableName, sub.opts.ManualAcks)
+		}
+
+		// После переподключения подписка восстанавливается с теми же параметрами
+		conn.subs = nil
+		if err := nc.resubscribe(); err != nil {
+			t.Fatal(err)
+		}
+		if len(conn.subs) != 1 || conn.subs[0].queueGroup != tc.queueGroup {
+			t.Errorf("%s: восстановленные подписки %+v", tc.name, conn.subs)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"orders-service/model"
+)
+
+// OrderChange описывает уведомление об изменении заказа, передаваемое через NOTIFY
+type OrderChange struct {
+	OrderUID string `json:"order_uid"`
+	Source   string `json:"source"`
+}
+
+// notifyChange ставит в очередь транзакции NOTIFY с ID заказа.
+// Если канал не настроен, ничего не делает.
+func (db *DB) notifyChange(ctx context.Context, tx pgx.Tx, orderUID string) error {
+	if db.notifyChannel == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(OrderChange{OrderUID: orderUID, Source: db.instanceID})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", db.notifyChannel, string(payload))
+	return err
+}
+
+// Listen выполняет LISTEN на канале и вызывает handler для каждого уведомления.
+// onConnect вызывается после каждого (пере)подключения, чтобы можно было
+// наверстать изменения, пропущенные пока соединения не было.
+// Функция блокируется до отмены ctx.
+func (db *DB) Listen(ctx context.Context, channel string, onConnect func(), handler func(OrderChange)) {
+	backoff := time.Second
+	for {
+		err := db.listenOnce(ctx, channel, onConnect, handler)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("LISTEN %s прерван: %v. Повтор через %s", channel, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (db *DB) listenOnce(ctx context.Context, channel string, onConnect func(), handler func(OrderChange)) error {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("не удалось получить соединение: %w", err)
+	}
+	// Соединение с активным LISTEN нельзя возвращать в пул
+	defer conn.Hijack().Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("ошибка LISTEN: %w", err)
+	}
+	log.Printf("Подписка на уведомления PostgreSQL '%s' успешна", channel)
+
+	if onConnect != nil {
+		onConnect()
+	}
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var change OrderChange
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			log.Printf("Некорректное уведомление в канале %s: %v", channel, err)
+			continue
+		}
+		handler(change)
+	}
+}
+
+// CacheSync поддерживает кэш в согласованном состоянии между экземплярами сервиса
+type CacheSync struct {
+	db         *DB
+	cache      *OrderCache
+	instanceID string
+	onUpdate   []func(OrderEvent)
+	onErase    []func(orderUID string)
+	// listen и loadAll — db.Listen и db.GetAllOrders; тесты подменяют их
+	listen  func(ctx context.Context, channel string, onConnect func(), handler func(OrderChange))
+	loadAll func() ([]*Order, error)
+}
+
+// NewCacheSync создает синхронизатор кэша для экземпляра instanceID
+func NewCacheSync(db *DB, cache *OrderCache, instanceID string) *CacheSync {
+	return &CacheSync{
+		db:         db,
+		cache:      cache,
+		instanceID: instanceID,
+		listen:     db.Listen,
+		loadAll:    db.GetAllOrders,
+	}
+}
+
+// OnUpdate регистрирует функцию, вызываемую, когда заказ, сохраненный другим
+// экземпляром, попадает в кэш этого экземпляра
+func (s *CacheSync) OnUpdate(fn func(OrderEvent)) {
+	s.onUpdate = append(s.onUpdate, fn)
+}
+
+// OnErase регистрирует функцию, вызываемую, когда другой экземпляр удалил
+// заказ или обезличил его при удалении данных покупателя
+func (s *CacheSync) OnErase(fn func(orderUID string)) {
+	s.onErase = append(s.onErase, fn)
+}
+
+// Run слушает уведомления об изменениях и обновляет кэш до отмены ctx. Кэш
+// перезагружается после каждого подключения, включая первое: изменение,
+// сделанное между начальной загрузкой кэша и LISTEN, иначе было бы потеряно.
+func (s *CacheSync) Run(ctx context.Context, channel string) {
+	s.listen(ctx, channel, s.reload, func(change OrderChange) {
+		if change.Source == s.instanceID {
+			return
+		}
+		s.Refresh(change.OrderUID)
+	})
+}
+
+// Refresh перечитывает заказ из базы данных, а если его там больше нет — удаляет из кэша
+func (s *CacheSync) Refresh(orderUID string) {
+	order, err := s.db.GetOrder(orderUID)
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			s.cache.Delete(orderUID)
+			s.erased(orderUID)
+			log.Printf("Заказ %s удален из кэша по уведомлению", orderUID)
+			return
+		}
+		log.Printf("Не удалось обновить заказ %s в кэше: %v", orderUID, err)
+		return
+	}
+	if order.CustomerID == erasedCustomerID {
+		s.erased(orderUID)
+	}
+
+	event := OrderEvent{Type: model.EventOrderCreated, Order: order, At: time.Now().UTC()}
+	if _, exists := s.cache.Get(orderUID); exists {
+		event.Type = model.EventOrderUpdated
+	}
+	s.cache.Set(orderUID, order)
+	log.Printf("Заказ %s обновлен в кэше по уведомлению", orderUID)
+	for _, fn := range s.onUpdate {
+		fn(event)
+	}
+}
+
+// erased сообщает подписчикам OnErase об удаленном или обезличенном заказе
+func (s *CacheSync) erased(orderUID string) {
+	for _, fn := range s.onErase {
+		fn(orderUID)
+	}
+}
+
+// reload полностью перезагружает кэш после подключения к каналу уведомлений
+func (s *CacheSync) reload() {
+	orders, err := s.loadAll()
+	if err != nil {
+		log.Printf("Не удалось перезагрузить кэш: %v", err)
+		return
+	}
+
+	s.cache.Replace(orders)
+	log.Printf("Кэш перезагружен после подключения к уведомлениям: %d заказов", len(orders))
+}
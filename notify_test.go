@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCacheSyncReloadsOnEveryConnect(t *testing.T) {
+	cache := NewOrderCache()
+	initial := testOrder(t)
+	cache.Set(initial.OrderUID, initial)
+
+	// Заказ сохранен другим экземпляром между начальной загрузкой кэша и
+	// LISTEN, а пока соединения не было — удален
+	missed := testOrder(t)
+	missed.OrderUID = "missed-order"
+	db := [][]*Order{{initial, missed}, nil, {initial}}
+
+	s := NewCacheSync(nil, cache, "test")
+	loads := 0
+	s.loadAll = func() ([]*Order, error) {
+		state := db[loads]
+		loads++
+		if state == nil {
+			return nil, errors.New("БД недоступна")
+		}
+		return state, nil
+	}
+	s.listen = func(ctx context.Context, channel string, onConnect func(), handler func(OrderChange)) {
+		onConnect()
+		if _, ok := cache.Get(missed.OrderUID); !ok {
+			t.Error("первое подключение: заказ, сохраненный до LISTEN, не загружен")
+		}
+		// Ошибка перезагрузки не очищает кэш
+		onConnect()
+		if _, ok := cache.Get(missed.OrderUID); !ok {
+			t.Error("неудачная перезагрузка изменила кэш")
+		}
+		onConnect()
+		if _, ok := cache.Get(missed.OrderUID); ok {
+			t.Error("переподключение: удаленный заказ остался в кэше")
+		}
+	}
+	s.Run(context.Background(), "orders")
+
+	if loads != 3 {
+		t.Errorf("кэш перезагружен %d раз, ожидалось 3", loads)
+	}
+	if _, ok := cache.Get(initial.OrderUID); !ok {
+		t.Error("заказ из БД пропал из кэша")
+	}
+}
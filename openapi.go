@@ -0,0 +1,113 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// openAPISpec — описание HTTP API в формате OpenAPI 3. При добавлении или
+// изменении маршрута в routes() нужно обновить и openapi.json: при старте
+// сервис сверяет маршруты роутера со спецификацией и пишет в лог расхождения.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// undocumentedRoutes — HTML-страницы и статика, которые не входят в спецификацию API
+var undocumentedRoutes = map[string]bool{
+	"/":             true,
+	"/docs":         true,
+	docsAssetsPath: true,
+}
+
+// docsAssetsPath — префикс файлов Swagger UI. Они встроены в бинарный файл,
+// поэтому документация открывается и без доступа в интернет.
+const docsAssetsPath = "/docs/assets/"
+
+func (s *Server) handleOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	}
+}
+
+func (s *Server) handleDocs() http.HandlerFunc {
+	const page = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <title>Сервис заказов L0 — API</title>
+    <link rel="stylesheet" href="/docs/assets/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="/docs/assets/swagger-ui-bundle.js"></script>
+    <script>
+        SwaggerUIBundle({ url: '/openapi.json', dom_id: '#swagger-ui' });
+    </script>
+</body>
+</html>`
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}
+}
+
+// handleDocsAssets отдает встроенные файлы Swagger UI
+func (s *Server) handleDocsAssets() http.Handler {
+	files := http.StripPrefix(docsAssetsPath, http.FileServer(http.FS(swaggerFiles.FS)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// undocumentedOperations возвращает маршруты роутера (в виде "GET /path"),
+// которых нет в спецификации
+func undocumentedOperations(router *mux.Router, spec []byte) ([]string, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("ошибка разбора openapi.json: %w", err)
+	}
+
+	var missing []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || undocumentedRoutes[path] {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+				missing = append(missing, method+" "+path)
+			}
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing, err
+}
+
+// checkOpenAPI пишет в лог маршруты, не описанные в спецификации
+func (s *Server) checkOpenAPI() {
+	missing, err := undocumentedOperations(s.router, openAPISpec)
+	if err != nil {
+		log.Printf("Не удалось сверить маршруты с OpenAPI: %v", err)
+		return
+	}
+	for _, op := range missing {
+		log.Printf("Маршрут %s не описан в openapi.json", op)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutesDocumentedInOpenAPI(t *testing.T) {
+	missing, err := undocumentedOperations(NewServer(NewOrderCache(), nil, nil).router, openAPISpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range missing {
+		t.Errorf("маршрут %s не описан в openapi.json", op)
+	}
+}
+
+func TestDocsServedWithoutCDN(t *testing.T) {
+	router := NewServer(NewOrderCache(), nil, nil).router
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if strings.Contains(rec.Body.String(), "https://") {
+		t.Errorf("страница /docs загружает внешние ресурсы:\n%s", rec.Body.String())
+	}
+
+	for _, asset := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, docsAssetsPath+asset, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("%s: статус %d, %d байт", asset, rec.Code, rec.Body.Len())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package orderpb
+
+import (
+	"time"
+
+	types "github.com/gogo/protobuf/types"
+
+	"orders-service/model"
+)
+
+// FromModel преобразует заказ в protobuf-представление
+func FromModel(order *model.Order) *Order {
+	pb := &Order{
+		OrderUid:          order.OrderUID,
+		TrackNumber:       order.TrackNumber,
+		Entry:             order.Entry,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerId:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmId:              int64(order.SMID),
+		OofShard:          order.OOFShard,
+		Delivery: &Delivery{
+			Name:    order.Delivery.Name,
+			Phone:   order.Delivery.Phone,
+			Zip:     order.Delivery.Zip,
+			City:    order.Delivery.City,
+			Address: order.Delivery.Address,
+			Region:  order.Delivery.Region,
+			Email:   order.Delivery.Email,
+		},
+		Payment: &Payment{
+			Transaction:  order.Payment.Transaction,
+			RequestId:    order.Payment.RequestID,
+			Currency:     order.Payment.Currency,
+			Provider:     order.Payment.Provider,
+			Amount:       int64(order.Payment.Amount),
+			PaymentDt:    order.Payment.PaymentDt,
+			Bank:         order.Payment.Bank,
+			DeliveryCost: int64(order.Payment.DeliveryCost),
+			GoodsTotal:   int64(order.Payment.GoodsTotal),
+			CustomFee:    int64(order.Payment.CustomFee),
+		},
+	}
+	if !order.DateCreated.IsZero() {
+		pb.DateCreated = &types.Timestamp{
+			Seconds: order.DateCreated.Unix(),
+			Nanos:   int32(order.DateCreated.Nanosecond()),
+		}
+	}
+	for _, it := range order.Items {
+		pb.Items = append(pb.Items, &Item{
+			ChrtId:      int64(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int64(it.Price),
+			Rid:         it.RID,
+			Name:        it.Name,
+			Sale:        int64(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int64(it.TotalPrice),
+			NmId:        int64(it.NMID),
+			Brand:       it.Brand,
+			Status:      int64(it.Status),
+		})
+	}
+	return pb
+}
+
+// ToModel преобразует protobuf-заказ в модель
+func (pb *Order) ToModel() *model.Order {
+	order := &model.Order{
+		OrderUID:          pb.OrderUid,
+		TrackNumber:       pb.TrackNumber,
+		Entry:             pb.Entry,
+		Locale:            pb.Locale,
+		InternalSignature: pb.InternalSignature,
+		CustomerID:        pb.CustomerId,
+		DeliveryService:   pb.DeliveryService,
+		Shardkey:          pb.Shardkey,
+		SMID:              int(pb.SmId),
+		OOFShard:          pb.OofShard,
+	}
+	if pb.DateCreated != nil {
+		order.DateCreated = time.Unix(pb.DateCreated.Seconds, int64(pb.DateCreated.Nanos)).UTC()
+	}
+	if d := pb.Delivery; d != nil {
+		order.Delivery = model.Delivery{
+			Name:    d.Name,
+			Phone:   d.Phone,
+			Zip:     d.Zip,
+			City:    d.City,
+			Address: d.Address,
+			Region:  d.Region,
+			Email:   d.Email,
+		}
+	}
+	if p := pb.Payment; p != nil {
+		order.Payment = model.Payment{
+			Transaction:  p.Transaction,
+			RequestID:    p.RequestId,
+			Currency:     p.Currency,
+			Provider:     p.Provider,
+			Amount:       int(p.Amount),
+			PaymentDt:    p.PaymentDt,
+			Bank:         p.Bank,
+			DeliveryCost: int(p.DeliveryCost),
+			GoodsTotal:   int(p.GoodsTotal),
+			CustomFee:    int(p.CustomFee),
+		}
+	}
+	for _, it := range pb.Items {
+		order.Items = append(order.Items, model.Item{
+			ChrtID:      int(it.ChrtId),
+			TrackNumber: it.TrackNumber,
+			Price:       int(it.Price),
+			RID:         it.Rid,
+			Name:        it.Name,
+			Sale:        int(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int(it.TotalPrice),
+			NMID:        int(it.NmId),
+			Brand:       it.Brand,
+			Status:      int(it.Status),
+		})
+	}
+	return order
+}
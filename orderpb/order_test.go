@@ -0,0 +1,145 @@
+package orderpb
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	types "github.com/gogo/protobuf/types"
+)
+
+// protoField — поле сообщения из order.proto
+type protoField struct {
+	typ      string
+	repeated bool
+	number   int
+}
+
+var (
+	messageLine = regexp.MustCompile(`^message (\w+) \{$`)
+	fieldLine   = regexp.MustCompile(`^(repeated )?([\w.]+) (\w+) = (\d+);$`)
+)
+
+// parseProto читает сообщения order.proto: имя сообщения → имя поля → поле
+func parseProto(t *testing.T) map[string]map[string]protoField {
+	t.Helper()
+	f, err := os.Open("order.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	messages := make(map[string]map[string]protoField)
+	var current map[string]protoField
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case messageLine.MatchString(line):
+			current = make(map[string]protoField)
+			messages[messageLine.FindStringSubmatch(line)[1]] = current
+		case line == "}":
+			current = nil
+		case current != nil && fieldLine.MatchString(line):
+			m := fieldLine.FindStringSubmatch(line)
+			number, _ := strconv.Atoi(m[4])
+			current[m[3]] = protoField{typ: m[2], repeated: m[1] != "", number: number}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// goTypes — Go-типы сообщений order.proto
+var goTypes = map[string]reflect.Type{
+	"Order":    reflect.TypeOf(Order{}),
+	"Delivery": reflect.TypeOf(Delivery{}),
+	"Payment":  reflect.TypeOf(Payment{}),
+	"Item":     reflect.TypeOf(Item{}),
+}
+
+// expectedGoType возвращает Go-тип и тип кодирования для типа поля proto
+func expectedGoType(t *testing.T, typ string) (reflect.Type, string) {
+	t.Helper()
+	switch typ {
+	case "string":
+		return reflect.TypeOf(""), "bytes"
+	case "int64":
+		return reflect.TypeOf(int64(0)), "varint"
+	case "google.protobuf.Timestamp":
+		return reflect.TypeOf(&types.Timestamp{}), "bytes"
+	}
+	if msg, ok := goTypes[typ]; ok {
+		return reflect.PointerTo(msg), "bytes"
+	}
+	t.Fatalf("тип %s из order.proto не поддерживается тестом", typ)
+	return nil, ""
+}
+
+// TestStructTagsMatchProto сверяет теги protobuf в order.go с order.proto:
+// типы в order.go поддерживаются вручную, и расхождение молча меняет формат
+// на проводе
+func TestStructTagsMatchProto(t *testing.T) {
+	messages := parseProto(t)
+	if len(messages) != len(goTypes) {
+		t.Fatalf("в order.proto %d сообщений, в order.go %d", len(messages), len(goTypes))
+	}
+
+	for name, fields := range messages {
+		typ, ok := goTypes[name]
+		if !ok {
+			t.Errorf("сообщение %s отсутствует в order.go", name)
+			continue
+		}
+		seen := make(map[string]bool)
+		for i := 0; i < typ.NumField(); i++ {
+			sf := typ.Field(i)
+			tag := strings.Split(sf.Tag.Get("protobuf"), ",")
+			if len(tag) < 4 {
+				t.Errorf("%s.%s: нет тега protobuf", name, sf.Name)
+				continue
+			}
+			wire, number, label := tag[0], tag[1], tag[2]
+			fieldName, _ := strings.CutPrefix(tag[3], "name=")
+
+			pf, ok := fields[fieldName]
+			if !ok {
+				t.Errorf("%s.%s: поля %s нет в order.proto", name, sf.Name, fieldName)
+				continue
+			}
+			seen[fieldName] = true
+
+			if number != strconv.Itoa(pf.number) {
+				t.Errorf("%s.%s: номер %s, в order.proto %d", name, fieldName, number, pf.number)
+			}
+			goType, wantWire := expectedGoType(t, pf.typ)
+			wantLabel := "opt"
+			if pf.repeated {
+				goType, wantLabel = reflect.SliceOf(goType), "rep"
+			}
+			if wire != wantWire || label != wantLabel {
+				t.Errorf("%s.%s: тег %s,%s, ожидался %s,%s", name, fieldName, wire, label, wantWire, wantLabel)
+			}
+			if sf.Type != goType {
+				t.Errorf("%s.%s: Go-тип %s, ожидался %s", name, fieldName, sf.Type, goType)
+			}
+			if !strings.Contains(sf.Tag.Get("protobuf"), ",proto3") {
+				t.Errorf("%s.%s: в теге нет proto3", name, fieldName)
+			}
+			if json, _, _ := strings.Cut(sf.Tag.Get("json"), ","); json != fieldName {
+				t.Errorf("%s.%s: JSON-имя %q", name, fieldName, json)
+			}
+		}
+		for fieldName := range fields {
+			if !seen[fieldName] {
+				t.Errorf("поле %s.%s из order.proto отсутствует в order.go", name, fieldName)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownKey возвращается, когда строка зашифрована ключом, которого нет в наборе
+var ErrUnknownKey = errors.New("неизвестный ключ шифрования")
+
+// PIIKeyConfig — источник ключей шифрования персональных данных: файл или
+// переменная окружения. Если не задано ни то ни другое, данные хранятся открыто.
+type PIIKeyConfig struct {
+	// KeyFile — JSON-файл {"active": "id", "keys": {"id": "base64"}}
+	KeyFile string
+	// Keys — ключи в виде "id:base64,id:base64"
+	Keys string
+	// ActiveKey — ID ключа для нового шифрования; обязателен, если ключей несколько
+	ActiveKey string
+}
+
+// Keyring — набор ключей шифрования ключей (KEK). Каждая строка delivery
+// шифруется собственным ключом данных (DEK), который хранится рядом в
+// зашифрованном KEK виде вместе с ID этого KEK. Поэтому для ротации достаточно
+// добавить новый KEK, сделать его активным и перешифровать DEK командой reencrypt.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// LoadKeyring читает ключи. Возвращает nil, если шифрование не настроено.
+func LoadKeyring(cfg PIIKeyConfig) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte), active: cfg.ActiveKey}
+
+	switch {
+	case cfg.KeyFile != "":
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения файла ключей: %w", err)
+		}
+		var file struct {
+			Active string            `json:"active"`
+			Keys   map[string]string `json:"keys"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("ошибка разбора файла ключей %s: %w", cfg.KeyFile, err)
+		}
+		if k.active == "" {
+			k.active = file.Active
+		}
+		for id, encoded := range file.Keys {
+			if err := k.add(id, encoded); err != nil {
+				return nil, err
+			}
+		}
+	case cfg.Keys != "":
+		for _, pair := range strings.Split(cfg.Keys, ",") {
+			id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok {
+				return nil, fmt.Errorf("некорректный ключ %q: ожидается id:base64", id)
+			}
+			if err := k.add(id, encoded); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	if k.active == "" && len(k.keys) == 1 {
+		for id := range k.keys {
+			k.active = id
+		}
+	}
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("активный ключ %q не найден среди ключей %v", k.active, k.IDs())
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(id, encoded string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return fmt.Errorf("ключ %q: некорректный base64: %w", id, err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("ключ %q: нужно 32 байта для AES-256, получено %d", id, len(key))
+	}
+	k.keys[id] = key
+	return nil
+}
+
+// Active возвращает ID ключа, которым шифруются новые данные
+func (k *Keyring) Active() string {
+	return k.active
+}
+
+// IDs возвращает ID всех ключей набора
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NewDEK создает ключ данных и возвращает его вместе с зашифрованной активным
+// KEK копией для хранения в БД. orderUID привязывает ключ к строке.
+func (k *Keyring) NewDEK(orderUID string) (dek, wrapped []byte, err error) {
+	dek = make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, fmt.Errorf("ошибка генерации ключа данных: %w", err)
+	}
+	wrapped, err = k.WrapDEK(orderUID, dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dek, wrapped, nil
+}
+
+// WrapDEK шифрует ключ данных строки активным KEK
+func (k *Keyring) WrapDEK(orderUID string, dek []byte) ([]byte, error) {
+	return seal(k.keys[k.active], dek, []byte(orderUID))
+}
+
+// UnwrapDEK расшифровывает ключ данных строки ключом keyID
+func (k *Keyring) UnwrapDEK(keyID, orderUID string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	dek, err := unseal(kek, wrapped, []byte(orderUID))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки ключа данных заказа %s: %w", orderUID, err)
+	}
+	return dek, nil
+}
+
+// RewrapDEK перешифровывает активным KEK ключ данных, зашифрованный ключом keyID
+func (k *Keyring) RewrapDEK(keyID, orderUID string, wrapped []byte) ([]byte, error) {
+	dek, err := k.UnwrapDEK(keyID, orderUID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped, err := k.WrapDEK(orderUID, dek)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка шифрования ключа данных заказа %s: %w", orderUID, err)
+	}
+	return rewrapped, nil
+}
+
+// deadLetterBinding заменяет order_uid при шифровании недоставленных
+// сообщений: отклоненное сообщение может не содержать номера заказа. Ключ
+// данных у каждого сообщения свой, поэтому подмена строк целиком ничего не
+// раскрывает.
+const deadLetterBinding = "dead_letters"
+
+// encryptPayload шифрует исходные байты недоставленного сообщения
+func encryptPayload(dek, payload []byte) ([]byte, error) {
+	return seal(dek, payload, []byte(deadLetterBinding+"/payload"))
+}
+
+// decryptPayload расшифровывает результат encryptPayload
+func decryptPayload(dek, sealed []byte) ([]byte, error) {
+	plain, err := unseal(dek, sealed, []byte(deadLetterBinding+"/payload"))
+	if err != nil {
+		return nil, fmt.Errorf("недоставленное сообщение: %w", err)
+	}
+	return plain, nil
+}
+
+// piiColumns — зашифрованные поля таблицы delivery
+var piiColumns = []struct {
+	name string
+	ref  func(*Delivery) *string
+}{
+	{"name", func(d *Delivery) *string { return &d.Name }},
+	{"phone", func(d *Delivery) *string { return &d.Phone }},
+	{"email", func(d *Delivery) *string { return &d.Email }},
+	{"address", func(d *Delivery) *string { return &d.Address }},
+}
+
+// encryptDelivery возвращает копию доставки с зашифрованными полями
+// piiColumns. Значение привязано к заказу и полю, поэтому его нельзя
+// незаметно перенести в другую строку или столбец.
+func encryptDelivery(dek []byte, orderUID string, d Delivery) (Delivery, error) {
+	for _, col := range piiColumns {
+		value := col.ref(&d)
+		sealed, err := seal(dek, []byte(*value), []byte(orderUID+"/"+col.name))
+		if err != nil {
+			return d, err
+		}
+		*value = base64.StdEncoding.EncodeToString(sealed)
+	}
+	return d, nil
+}
+
+// decryptDelivery расшифровывает поля piiColumns на месте
+func decryptDelivery(dek []byte, orderUID string, d *Delivery) error {
+	for _, col := range piiColumns {
+		value := col.ref(d)
+		sealed, err := base64.StdEncoding.DecodeString(*value)
+		if err != nil {
+			return fmt.Errorf("поле %s заказа %s: %w", col.name, orderUID, err)
+		}
+		plain, err := unseal(dek, sealed, []byte(orderUID+"/"+col.name))
+		if err != nil {
+			return fmt.Errorf("поле %s заказа %s: %w", col.name, orderUID, err)
+		}
+		*value = string(plain)
+	}
+	return nil
+}
+
+// seal шифрует AES-256-GCM; результат — nonce и шифротекст подряд
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// unseal расшифровывает результат seal
+func unseal(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("шифротекст слишком короткий")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки: %w", err)
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testKey возвращает случайный ключ в формате PII_KEYS
+func testKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// testKeyring собирает набор ключей из пар "id:base64"
+func testKeyring(t *testing.T, active string, pairs ...string) *Keyring {
+	t.Helper()
+	k, err := LoadKeyring(PIIKeyConfig{Keys: strings.Join(pairs, ","), ActiveKey: active})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key := testKey(t)
+	for _, tc := range []struct {
+		name    string
+		cfg     PIIKeyConfig
+		active  string
+		wantErr bool
+	}{
+		{"один ключ становится активным", PIIKeyConfig{Keys: "k1:" + key}, "k1", false},
+		{"активный ключ из нескольких", PIIKeyConfig{Keys: "k1:" + key + ", k2:" + testKey(t), ActiveKey: "k2"}, "k2", false},
+		{"несколько ключей без активного", PIIKeyConfig{Keys: "k1:" + key + ",k2:" + testKey(t)}, "", true},
+		{"активный ключ не из набора", PIIKeyConfig{Keys: "k1:" + key, ActiveKey: "k3"}, "", true},
+		{"нет ID", PIIKeyConfig{Keys: key}, "", true},
+		{"не base64", PIIKeyConfig{Keys: "k1:не-base64"}, "", true},
+		{"короткий ключ", PIIKeyConfig{Keys: "k1:" + base64.StdEncoding.EncodeToString([]byte("short"))}, "", true},
+	} {
+		k, err := LoadKeyring(tc.cfg)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: ошибка %v", tc.name, err)
+			continue
+		}
+		if err == nil && k.Active() != tc.active {
+			t.Errorf("%s: активный ключ %q, ожидался %q", tc.name, k.Active(), tc.active)
+		}
+	}
+
+	if k, err := LoadKeyring(PIIKeyConfig{}); k != nil || err != nil {
+		t.Errorf("без ключей: %v, %v", k, err)
+	}
+}
+
+func TestDeliveryEncryptionRoundTrip(t *testing.T) {
+	keyring := testKeyring(t, "", "k1:"+testKey(t))
+	db := &DB{keyring: keyring}
+	order := testOrder(t)
+
+	sealed, keyID, wrapped, err := db.sealDelivery(order.OrderUID, order.Delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID == nil || *keyID != "k1" {
+		t.Fatalf("ID ключа %v, ожидался k1", keyID)
+	}
+	for _, col := range piiColumns {
+		if *col.ref(&sealed) == *col.ref(&order.Delivery) {
+			t.Errorf("поле %s не зашифровано", col.name)
+		}
+	}
+	if sealed.City != order.Delivery.City || sealed.Zip != order.Delivery.Zip {
+		t.Errorf("зашифрованы поля вне piiColumns: %+v", sealed)
+	}
+
+	opened := sealed
+	if err := db.openDelivery(order.OrderUID, keyID, wrapped, &opened); err != nil {
+		t.Fatal(err)
+	}
+	if opened != order.Delivery {
+		t.Errorf("расшифровано %+v, ожидалось %+v", opened, order.Delivery)
+	}
+
+	// Шифротекст привязан к заказу: в чужой строке он не расшифровывается
+	moved := sealed
+	if err := db.openDelivery("other-order", keyID, wrapped, &moved); err == nil {
+		t.Error("ключ данных расшифрован для чужого заказа")
+	}
+	// Открытые строки читаются как есть
+	plain := order.Delivery
+	if err := db.openDelivery(order.OrderUID, nil, nil, &plain); err != nil || plain != order.Delivery {
+		t.Errorf("открытая строка: %v, %+v", err, plain)
+	}
+}
+
+func TestDeliveryDecryptionFailsWithWrongOrMissingKey(t *testing.T) {
+	order := testOrder(t)
+	db := &DB{keyring: testKeyring(t, "", "k1:"+testKey(t))}
+	sealed, keyID, wrapped, err := db.sealDelivery(order.OrderUID, order.Delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Тот же ID, другой ключ
+	wrong := &DB{keyring: testKeyring(t, "", "k1:"+testKey(t))}
+	d := sealed
+	if err := wrong.openDelivery(order.OrderUID, keyID, wrapped, &d); err == nil {
+		t.Error("данные расшифрованы чужим ключом")
+	}
+
+	// Ключа с таким ID нет в наборе
+	missing := &DB{keyring: testKeyring(t, "", "k2:"+testKey(t))}
+	d = sealed
+	if err := missing.openDelivery(order.OrderUID, keyID, wrapped, &d); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ожидалась ErrUnknownKey, получено %v", err)
+	}
+
+	// Ключи не заданы вовсе
+	d = sealed
+	if err := (&DB{}).openDelivery(order.OrderUID, keyID, wrapped, &d); err == nil {
+		t.Error("зашифрованная строка прочитана без ключей")
+	}
+}
+
+func TestKeyRotationRewrapsDEK(t *testing.T) {
+	oldKey, newKey := "old:"+testKey(t), "new:"+testKey(t)
+	order := testOrder(t)
+	before := &DB{keyring: testKeyring(t, "old", oldKey)}
+	sealed, keyID, wrapped, err := before.sealDelivery(order.OrderUID, order.Delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeyring(t, "new", oldKey, newKey)
+	rewrapped, err := rotated.RewrapDEK(*keyID, order.OrderUID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// После перешифрования старый ключ можно удалить из набора
+	after := &DB{keyring: testKeyring(t, "new", newKey)}
+	d := sealed
+	newID := "new"
+	if err := after.openDelivery(order.OrderUID, &newID, rewrapped, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d != order.Delivery {
+		t.Errorf("расшифровано %+v, ожидалось %+v", d, order.Delivery)
+	}
+	if _, err := after.keyring.RewrapDEK(*keyID, order.OrderUID, wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("перешифрование без старого ключа: %v", err)
+	}
+}
+
+func TestDeadLetterPayloadEncryption(t *testing.T) {
+	payload := []byte(`{"order_uid":"b563feb7b2b84b6test","delivery":{"phone":"+9720000000"}}`)
+	db := &DB{keyring: testKeyring(t, "", "k1:"+testKey(t))}
+
+	sealed, keyID, wrapped, err := db.sealPayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID == nil || bytes.Contains(sealed, []byte("+9720000000")) {
+		t.Fatalf("сообщение сохраняется открыто: keyID=%v", keyID)
+	}
+	opened, err := db.openPayload(keyID, wrapped, sealed)
+	if err != nil || !bytes.Equal(opened, payload) {
+		t.Errorf("расшифровано %q, %v", opened, err)
+	}
+
+	if _, err := (&DB{}).openPayload(keyID, wrapped, sealed); err == nil {
+		t.Error("зашифрованное сообщение прочитано без ключей")
+	}
+	other := &DB{keyring: testKeyring(t, "", "k2:"+testKey(t))}
+	if _, err := other.openPayload(keyID, wrapped, sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ожидалась ErrUnknownKey, получено %v", err)
+	}
+	if plain, keyID, _, err := (&DB{}).sealPayload(payload); err != nil || keyID != nil || !bytes.Equal(plain, payload) {
+		t.Errorf("без ключей сообщение должно сохраняться как есть: %v", err)
+	}
+}
+
+// TestReencryptPIIPostgres шифрует заказ и недоставленное сообщение старым
+// ключом, переводит их на новый командой ReencryptPII и читает без старого
+// ключа. Нужна БД со схемой сервиса в TEST_DATABASE_URL.
+func TestReencryptPIIPostgres(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	db, err := NewDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	oldKey, newKey := "old:"+testKey(t), "new:"+testKey(t)
+	encrypted := testOrder(t)
+	encrypted.OrderUID = "reencrypt-old-key"
+	plain := testOrder(t)
+	plain.OrderUID = "reencrypt-plain"
+	uids := []string{encrypted.OrderUID, plain.OrderUID}
+	var deadLetters []int64
+	defer func() {
+		tx, err := db.pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback(ctx)
+		if err := deleteOrders(ctx, tx, uids); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM dead_letters WHERE id = ANY($1)`, deadLetters); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := db.SaveOrder(plain); err != nil {
+		t.Fatal(err)
+	}
+	db.SetKeyring(testKeyring(t, "old", oldKey))
+	if err := db.SaveOrder(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	dl := &DeadLetter{Kind: DeadLetterRejected, Source: "test", Payload: []byte(`{"order_uid":"reencrypt-old-key"}`)}
+	if err := db.SaveDeadLetter(dl); err != nil {
+		t.Fatal(err)
+	}
+	deadLetters = append(deadLetters, dl.ID)
+
+	db.SetKeyring(testKeyring(t, "new", oldKey, newKey))
+	report, err := db.ReencryptPII(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rewrapped < 2 || report.Encrypted < 1 {
+		t.Errorf("итог перешифрования %+v", report)
+	}
+
+	db.SetKeyring(testKeyring(t, "new", newKey))
+	for _, want := range []*Order{encrypted, plain} {
+		var keyID *string
+		if err := db.pool.QueryRow(ctx, `SELECT pii_key_id FROM delivery WHERE order_uid = $1`,
+			want.OrderUID).Scan(&keyID); err != nil {
+			t.Fatal(err)
+		}
+		if keyID == nil || *keyID != "new" {
+			t.Errorf("заказ %s зашифрован ключом %v", want.OrderUID, keyID)
+		}
+		got, err := db.GetOrder(want.OrderUID)
+		if err != nil {
+			t.Fatalf("заказ %s без старого ключа: %v", want.OrderUID, err)
+		}
+		if got.Delivery != want.Delivery {
+			t.Errorf("заказ %s: доставка %+v, ожидалась %+v", want.OrderUID, got.Delivery, want.Delivery)
+		}
+	}
+
+	var payload, wrapped []byte
+	var keyID *string
+	if err := db.pool.QueryRow(ctx, `SELECT payload, pii_key_id, pii_dek FROM dead_letters WHERE id = $1`,
+		dl.ID).Scan(&payload, &keyID, &wrapped); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := db.openPayload(keyID, wrapped, payload)
+	if err != nil || !bytes.Equal(opened, dl.Payload) {
+		t.Errorf("недоставленное сообщение: %q, %v", opened, err)
+	}
+}
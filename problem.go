@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Коды ошибок API. Код — стабильная часть ответа, по нему клиенты различают
+// ошибки; текст сообщения зависит от языка и может меняться.
+const (
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeOrderNotFound    = "order_not_found"
+	CodeWebhookNotFound  = "webhook_not_found"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidOrder     = "invalid_order"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeUnavailable      = "unavailable"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+)
+
+// problemTitles — сообщения об ошибках на поддерживаемых языках
+var problemTitles = map[string]map[string]string{
+	CodeNotFound:         {"ru": "Ресурс не найден", "en": "Resource not found"},
+	CodeMethodNotAllowed: {"ru": "Метод не поддерживается", "en": "Method not allowed"},
+	CodeOrderNotFound:    {"ru": "Заказ не найден", "en": "Order not found"},
+	CodeWebhookNotFound:  {"ru": "Вебхук не найден", "en": "Webhook not found"},
+	CodeInvalidParameter: {"ru": "Некорректный параметр запроса", "en": "Invalid request parameter"},
+	CodeInvalidRequest:   {"ru": "Некорректный запрос", "en": "Invalid request"},
+	CodeInvalidOrder:     {"ru": "Заказ не прошел проверку", "en": "Order validation failed"},
+	CodeBodyTooLarge:     {"ru": "Тело запроса слишком большое", "en": "Request body too large"},
+	CodeUnavailable:      {"ru": "Сервис временно недоступен, повторите запрос позже", "en": "Service temporarily unavailable, retry later"},
+	CodeUnauthorized:     {"ru": "Требуется аутентификация", "en": "Authentication required"},
+	CodeForbidden:        {"ru": "Недостаточно прав", "en": "Insufficient permissions"},
+	CodeRateLimited:      {"ru": "Слишком много запросов, повторите позже", "en": "Too many requests, retry later"},
+}
+
+// Problem — ошибка API в формате application/problem+json (RFC 9457)
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem отвечает ошибкой с кодом code. detail — необязательные
+// подробности, они не переводятся.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	problem := Problem{
+		Type:      "/problems/" + code,
+		Title:     problemTitle(code, preferredLanguage(r)),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestIDFrom(r.Context()),
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Content-Language", preferredLanguage(r))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// decodeJSON читает JSON-тело запроса в v. При ошибке отвечает 400 или 413
+// (тело больше лимита) и возвращает false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, err.Error())
+		return false
+	case err != nil:
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func problemTitle(code, lang string) string {
+	if title, ok := problemTitles[code][lang]; ok {
+		return title
+	}
+	return code
+}
+
+// preferredLanguage выбирает язык ответа по Accept-Language: первый
+// поддерживаемый язык в порядке убывания q, по умолчанию русский
+func preferredLanguage(r *http.Request) string {
+	best, bestQ := "ru", -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if lang != "ru" && lang != "en" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+type requestIDKey struct{}
+
+// withRequestID берет идентификатор запроса из заголовка X-Request-ID или
+// создает новый, кладет его в контекст и возвращает в ответе
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
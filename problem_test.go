@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// request выполняет запрос к router с заголовками headers (имя, значение, ...)
+func request(router http.Handler, method, path string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	return rec
+}
+
+// decodeProblem разбирает тело ответа как problem+json
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Fatalf("Content-Type %q, ожидался application/problem+json", got)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("тело не в формате problem+json: %v: %s", err, rec.Body)
+	}
+	return p
+}
+
+func TestProblemResponses(t *testing.T) {
+	router := newTestServer(t, NewOrderCache()).router
+	for _, tc := range []struct {
+		name, method, path string
+		status             int
+		code, instance     string
+	}{
+		{"нет заказа", http.MethodGet, "/api/order/missing", http.StatusNotFound, CodeOrderNotFound, "/api/order/missing"},
+		{"нет маршрута", http.MethodGet, "/api/nothing", http.StatusNotFound, CodeNotFound, "/api/nothing"},
+		{"неверный метод", http.MethodDelete, "/api/order/missing", http.StatusMethodNotAllowed, CodeMethodNotAllowed, "/api/order/missing"},
+	} {
+		rec := request(router, tc.method, tc.path, "X-API-Key", testAdminKey)
+		if rec.Code != tc.status {
+			t.Errorf("%s: статус %d, ожидался %d", tc.name, rec.Code, tc.status)
+			continue
+		}
+		p := decodeProblem(t, rec)
+		if p.Status != tc.status || p.Code != tc.code || p.Type != "/problems/"+tc.code || p.Instance != tc.instance {
+			t.Errorf("%s: %+v", tc.name, p)
+		}
+		if p.Title != problemTitles[tc.code]["ru"] {
+			t.Errorf("%s: заголовок %q", tc.name, p.Title)
+		}
+	}
+
+	// Без ключа — 401 в том же формате
+	rec := request(router, http.MethodGet, "/api/order/missing")
+	if p := decodeProblem(t, rec); rec.Code != http.StatusUnauthorized || p.Code != CodeUnauthorized {
+		t.Errorf("без ключа: статус %d, %+v", rec.Code, p)
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		header, want string
+	}{
+		{"", "ru"},
+		{"en", "en"},
+		{"en-US,en;q=0.9", "en"},
+		{"RU-ru", "ru"},
+		{"de, en;q=0.5", "en"},
+		{"de, fr", "ru"},
+		{"ru;q=0.4, en;q=0.8", "en"},
+		{"en;q=0.4, ru;q=0.8", "ru"},
+		{"en;q=0", "ru"},
+		{"en;q=abc, ru;q=0.1", "ru"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set("Accept-Language", tc.header)
+		}
+		if got := preferredLanguage(r); got != tc.want {
+			t.Errorf("Accept-Language %q: язык %s, ожидался %s", tc.header, got, tc.want)
+		}
+	}
+
+	router := newTestServer(t, NewOrderCache()).router
+	for lang, accept := range map[string]string{"ru": "ru-RU", "en": "en-GB, ru;q=0.5"} {
+		rec := request(router, http.MethodGet, "/api/order/missing",
+			"X-API-Key", testAdminKey, "Accept-Language", accept)
+		p := decodeProblem(t, rec)
+		if p.Title != problemTitles[CodeOrderNotFound][lang] {
+			t.Errorf("Accept-Language %q: заголовок %q", accept, p.Title)
+		}
+		if got := rec.Header().Get("Content-Language"); got != lang {
+			t.Errorf("Accept-Language %q: Content-Language %q", accept, got)
+		}
+	}
+}
+
+func TestProblemRequestID(t *testing.T) {
+	router := newTestServer(t, NewOrderCache()).router
+
+	// Идентификатор клиента возвращается в заголовке и в теле ошибки
+	rec := request(router, http.MethodGet, "/api/order/missing", "X-API-Key", testAdminKey, "X-Request-ID", "req-42")
+	if got := rec.Header().Get("X-Request-ID"); got != "req-42" {
+		t.Errorf("X-Request-ID %q, ожидался req-42", got)
+	}
+	if p := decodeProblem(t, rec); p.RequestID != "req-42" {
+		t.Errorf("request_id %q, ожидался req-42", p.RequestID)
+	}
+
+	// Без заголовка и со слишком длинным значением создается новый идентификатор
+	for name, id := range map[string]string{"без заголовка": "", "длинный": strings.Repeat("x", 129)} {
+		rec := request(router, http.MethodGet, "/api/nothing", "X-Request-ID", id)
+		generated := rec.Header().Get("X-Request-ID")
+		if generated == "" || generated == id {
+			t.Errorf("%s: X-Request-ID %q", name, generated)
+			continue
+		}
+		if p := decodeProblem(t, rec); p.RequestID != generated {
+			t.Errorf("%s: request_id %q, в заголовке %q", name, p.RequestID, generated)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"orders-service/model"
+)
+
+// Outcome — итог обработки одного сообщения с заказом
+type Outcome string
+
+const (
+	// OutcomeApplied — заказ сохранен в БД и кэш
+	OutcomeApplied Outcome = "applied"
+	// OutcomeSkipped — такой же заказ уже сохранен, изменений нет
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeRejected — сообщение некорректно и не может быть обработано
+	OutcomeRejected Outcome = "rejected"
+)
+
+// OrderProcessor — общий конвейер обработки заказов: разбор, валидация,
+// сохранение в БД и кэш. Используется подпиской NATS и повторным проигрыванием канала.
+type OrderProcessor struct {
+	db    *DB
+	cache *OrderCache
+	// strict отклоняет JSON-заказы с неизвестными полями
+	strict bool
+	// current возвращает сохраненную версию заказа, с которой сравнивается
+	// новая: по умолчанию из кэша, после CompareWithDB — из БД
+	current func(orderUID string) (*Order, bool)
+
+	onStored []func(OrderEvent)
+}
+
+// NewOrderProcessor создает конвейер обработки заказов
+func NewOrderProcessor(db *DB, cache *OrderCache, strict bool) *OrderProcessor {
+	return &OrderProcessor{
+		db:      db,
+		cache:   cache,
+		strict:  strict,
+		current: cache.Get,
+	}
+}
+
+// CompareWithDB сравнивает заказы с версией в БД, а не в кэше. Нужен
+// конвейеру с пустым кэшем (команда replay): иначе каждый заказ сохранялся бы
+// заново — с новым updated_at и событием для вебхуков.
+func (p *OrderProcessor) CompareWithDB() {
+	p.current = func(orderUID string) (*Order, bool) {
+		order, err := p.db.GetOrder(orderUID)
+		if err != nil {
+			if !errors.Is(err, ErrOrderNotFound) {
+				log.Printf("Не удалось прочитать заказ %s для сравнения: %v", orderUID, err)
+			}
+			return nil, false
+		}
+		return order, true
+	}
+}
+
+func init() {
+	metrics.Describe("orders_messages_total", "Обработанные сообщения с заказами по результату")
+	metrics.Describe("orders_unknown_fields_total", "Неизвестные поля в JSON-заказах, принятых в мягком режиме")
+	metrics.Describe("orders_dead_letters_total", "Сообщения, записанные в хранилище недоставленных")
+}
+
+// OrderEvent — событие сохранения заказа
+type OrderEvent struct {
+	// Type — model.EventOrderCreated или model.EventOrderUpdated
+	Type  string
+	Order *Order
+	At    time.Time
+}
+
+// OnStored регистрирует функцию, вызываемую после успешного сохранения заказа
+func (p *OrderProcessor) OnStored(fn func(OrderEvent)) {
+	p.onStored = append(p.onStored, fn)
+}
+
+// Process обрабатывает сообщение с заказом, полученное из source (например,
+// "nats:orders#42"). В режиме dryRun заказ только разбирается и проверяется,
+// но не сохраняется.
+// Ошибка вместе с OutcomeRejected означает некорректное сообщение, которое
+// бессмысленно обрабатывать повторно; ошибка с пустым Outcome — временный сбой.
+func (p *OrderProcessor) Process(data []byte, source string, dryRun bool) (Outcome, *Order, error) {
+	outcome, order, err := p.process(data, source, dryRun)
+	if !dryRun {
+		label := string(outcome)
+		if label == "" {
+			label = "failed"
+		}
+		metrics.Inc("orders_messages_total", "outcome", label)
+	}
+	return outcome, order, err
+}
+
+// unknownFieldSection возвращает часть заказа, в которой найдено неизвестное
+// поле: delivery, payment, items или order для полей верхнего уровня. Сами
+// пути приходят от производителя и в метку не попадают, иначе число рядов
+// метрики не ограничено.
+func unknownFieldSection(path string) string {
+	section, _, nested := strings.Cut(path, ".")
+	section, _, _ = strings.Cut(section, "[")
+	switch section {
+	case "delivery", "payment", "items":
+		if nested || strings.Contains(path, "[") {
+			return section
+		}
+	}
+	return "order"
+}
+
+func (p *OrderProcessor) process(data []byte, source string, dryRun bool) (Outcome, *Order, error) {
+	order, warnings, err := p.decodeOrder(data)
+	if err != nil {
+		if !dryRun {
+			p.deadLetter(DeadLetterRejected, source, err.Error(), nil, data)
+		}
+		return OutcomeRejected, nil, err
+	}
+
+	if len(warnings) > 0 && !dryRun {
+		for _, field := range warnings {
+			metrics.Inc("orders_unknown_fields_total", "section", unknownFieldSection(field))
+		}
+		log.Printf("Заказ %s содержит неизвестные поля: %s", order.OrderUID, strings.Join(warnings, ", "))
+		p.deadLetter(DeadLetterWarning, source, "неизвестные поля", warnings, data)
+	}
+
+	if p.unchanged(order) {
+		return OutcomeSkipped, order, nil
+	}
+	if dryRun {
+		return OutcomeApplied, order, nil
+	}
+
+	// Сохраняем в базу данных
+	if err := p.db.SaveOrder(order); err != nil {
+		return "", order, fmt.Errorf("ошибка сохранения заказа в БД: %w", err)
+	}
+
+	// Сохраняем в кэш
+	event := OrderEvent{Type: model.EventOrderCreated, Order: order, At: time.Now().UTC()}
+	if _, exists := p.cache.Get(order.OrderUID); exists {
+		event.Type = model.EventOrderUpdated
+	}
+	p.cache.Set(order.OrderUID, order)
+	for _, fn := range p.onStored {
+		fn(event)
+	}
+	return OutcomeApplied, order, nil
+}
+
+// unchanged сообщает, что в кэше уже лежит точно такой же заказ
+func (p *OrderProcessor) unchanged(order *Order) bool {
+	current, ok := p.current(order.OrderUID)
+	if !ok {
+		return false
+	}
+
+	// Сравниваем JSON-представления. time.Time из БД и из сообщения
+	// могут отличаться часовым поясом при одинаковом моменте времени,
+	// поэтому обе даты приводятся к UTC
+	a, b := *current, *order
+	a.DateCreated = a.DateCreated.UTC()
+	b.DateCreated = b.DateCreated.UTC()
+
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return bytes.Equal(aj, bj)
+}
+
+// decodeOrder разбирает и проверяет сообщение с заказом: в конверте или без,
+// в формате JSON или protobuf. Возвращает также пути неизвестных полей.
+func (p *OrderProcessor) decodeOrder(data []byte) (*Order, []string, error) {
+	msg, err := openEnvelope(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", model.ErrInvalidOrder, err)
+	}
+
+	order, warnings, err := msg.order(p.strict)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", model.ErrInvalidOrder, err)
+	}
+
+	if err := order.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return order, warnings, nil
+}
+
+// deadLetter сохраняет проблемное сообщение. Ошибка записи только логируется:
+// она не должна влиять на обработку самого сообщения.
+func (p *OrderProcessor) deadLetter(kind, source, reason string, warnings []string, data []byte) {
+	dl := &DeadLetter{
+		Kind:     kind,
+		Source:   source,
+		Reason:   reason,
+		Warnings: warnings,
+		Payload:  data,
+	}
+	if p.db == nil {
+		// Конвейер без БД (проверка HTTP API в тестах) сообщения не хранит
+		return
+	}
+	if err := p.db.SaveDeadLetter(dl); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	metrics.Inc("orders_dead_letters_total", "kind", kind)
+}
+
+// logOutcome пишет в лог результат обработки сообщения
+func logOutcome(outcome Outcome, order *Order, err error, data []byte) {
+	switch {
+	case outcome == OutcomeRejected:
+		log.Printf("Сообщение отклонено: %v. Данные: %s", err, string(data))
+	case err != nil:
+		log.Printf("%v", err)
+	case outcome == OutcomeSkipped:
+		log.Printf("Заказ %s не изменился, пропускаем", order.OrderUID)
+	default:
+		log.Printf("Заказ %s успешно обработан и сохранен", order.OrderUID)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"orders-service/model"
+)
+
+func TestProcessPaymentTransaction(t *testing.T) {
+	processor := NewOrderProcessor(nil, NewOrderCache(), false)
+
+	// Заказ первой версии без transaction получает его из order_uid
+	legacy := orderJSON(t, func(doc map[string]any) {
+		delete(section(doc, "payment"), "transaction")
+	})
+	outcome, order, err := processor.Process(legacy, "test", true)
+	if err != nil || outcome != OutcomeApplied {
+		t.Fatalf("заказ без transaction: %s, %v", outcome, err)
+	}
+	if order.Payment.Transaction != order.OrderUID {
+		t.Errorf("transaction %q, ожидался order_uid %q", order.Payment.Transaction, order.OrderUID)
+	}
+
+	// В текущей версии transaction обязан совпадать с order_uid
+	payload := orderJSON(t, func(doc map[string]any) {
+		section(doc, "payment")["transaction"] = "other-transaction"
+	})
+	current := envelopeJSON(t, model.SchemaVersion, model.FormatJSON, payload)
+	if outcome, _, err := processor.Process(current, "test", true); outcome != OutcomeRejected ||
+		err == nil || !strings.Contains(err.Error(), "payment.transaction") {
+		t.Errorf("чужой transaction: %s, %v", outcome, err)
+	}
+}
+
+func TestIngestRejectsMismatchedTransaction(t *testing.T) {
+	router := newTestServer(t, NewOrderCache()).router
+	order := testOrder(t)
+	order.Payment.Transaction = "other-transaction"
+	data, err := json.Marshal(model.Envelope{
+		SchemaVersion: model.SchemaVersion,
+		EventType:     model.EventOrderCreated,
+		Payload:       mustJSON(t, order),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", bytes.NewReader(data))
+	r.Header.Set("X-API-Key", testAdminKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("статус %d: %s", rec.Code, rec.Body)
+	}
+	if p := decodeProblem(t, rec); p.Code != CodeInvalidOrder || !strings.Contains(p.Detail, "payment.transaction") {
+		t.Errorf("ошибка %+v", p)
+	}
+}
+
+// mustJSON кодирует v в JSON
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
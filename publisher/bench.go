@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// benchOptions — параметры замера сквозной задержки
+type benchOptions struct {
+	n           int
+	concurrency int
+	apiURL      string
+	poll        time.Duration
+	timeout     time.Duration
+	seed        int64
+	// apiKey и token — учетные данные HTTP API (X-API-Key или Bearer JWT)
+	apiKey string
+	token  string
+}
+
+// visibility — момент публикации заказа и момент, когда он стал доступен через API
+type visibility struct {
+	uid       string
+	published time.Time
+	visible   time.Time
+	err       error
+	// throttled — сколько раз API ответил 429 на опрос этого заказа
+	throttled int
+}
+
+// runBench публикует bench.n заказов и опрашивает GET /api/order/{id}, пока
+// каждый заказ не станет доступен. Сквозная задержка считается от отправки
+// в NATS до первого ответа 200. Заказы отправляются в конверте, produced_at
+// которого совпадает с моментом публикации.
+func runBench(p *Publisher, opts *options, bench benchOptions, out io.Writer) error {
+	rng := rand.New(rand.NewSource(bench.seed))
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	jobs := make(chan visibility, bench.n)
+	results := make(chan visibility, bench.n)
+	var wg sync.WaitGroup
+	for i := 0; i < bench.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- waitVisible(client, bench, job)
+			}
+		}()
+	}
+
+	for i := 0; i < bench.n; i++ {
+		order := randomOrder(rng, i)
+		data, err := encodeOrder(order, opts.format, true)
+		if err != nil {
+			close(jobs)
+			return err
+		}
+		jobs <- visibility{uid: order.OrderUID, published: p.Publish(order.OrderUID, data)}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	var all []visibility
+	for r := range results {
+		all = append(all, r)
+	}
+	printBench(out, all)
+	return nil
+}
+
+// waitVisible опрашивает API, пока заказ не появится или не истечет таймаут.
+// Ответ 429 означает превышение лимита частоты: опрос откладывается на
+// Retry-After, а заказ не считается недоступным.
+func waitVisible(client *http.Client, bench benchOptions, job visibility) visibility {
+	url := fmt.Sprintf("%s/api/order/%s", bench.apiURL, job.uid)
+	deadline := job.published.Add(bench.timeout)
+	for time.Now().Before(deadline) {
+		wait := bench.poll
+		resp, err := client.Do(bench.request(url))
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusOK:
+				job.visible = time.Now()
+				return job
+			case http.StatusUnauthorized, http.StatusForbidden:
+				job.err = fmt.Errorf("API отказал в доступе (%d): укажите -api-key или -token", resp.StatusCode)
+				return job
+			case http.StatusTooManyRequests:
+				job.throttled++
+				wait = max(wait, retryAfter(resp))
+			}
+		}
+		time.Sleep(wait)
+	}
+	job.err = fmt.Errorf("заказ не появился за %s", bench.timeout)
+	return job
+}
+
+// request создает запрос к API с учетными данными
+func (b benchOptions) request(url string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if b.apiKey != "" {
+		req.Header.Set("X-API-Key", b.apiKey)
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	return req
+}
+
+// retryAfter возвращает паузу из заголовка Retry-After, по умолчанию секунду
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Second
+}
+
+// printBench выводит перцентили сквозной задержки и пропускную способность
+func printBench(w io.Writer, all []visibility) {
+	var latencies []time.Duration
+	var first, last time.Time
+	timeouts, throttled := 0, 0
+	for _, v := range all {
+		throttled += v.throttled
+		if v.err != nil {
+			timeouts++
+			continue
+		}
+		latencies = append(latencies, v.visible.Sub(v.published))
+		if first.IsZero() || v.published.Before(first) {
+			first = v.published
+		}
+		if v.visible.After(last) {
+			last = v.visible
+		}
+	}
+
+	fmt.Fprintf(w, "Сквозной замер: заказов %d, доступны через API %d, не дождались %d\n",
+		len(all), len(latencies), timeouts)
+	if throttled > 0 {
+		fmt.Fprintf(w, "Ответов 429 (лимит частоты запросов): %d — увеличьте -poll или RATE_LIMIT_READ\n", throttled)
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Fprintf(w, "Задержка публикация → API: p50=%s p95=%s p99=%s max=%s\n",
+		percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99),
+		latencies[len(latencies)-1].Round(time.Microsecond))
+	if span := last.Sub(first); span > 0 {
+		fmt.Fprintf(w, "Пропускная способность: %.1f заказов/с\n", float64(len(latencies))/span.Seconds())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"orders-service/model"
+)
+
+// fakeAPI — HTTP API сервиса, в котором заказ появляется после публикации
+// в conn. Первые delay опросов каждого заказа получают 404.
+type fakeAPI struct {
+	conn  *fakeConn
+	delay int
+
+	mu    sync.Mutex
+	polls map[string]int
+	auth  []string
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	uid := strings.TrimPrefix(r.URL.Path, "/api/order/")
+	a.mu.Lock()
+	a.auth = append(a.auth, r.Header.Get("X-API-Key"))
+	a.polls[uid]++
+	polls := a.polls[uid]
+	a.mu.Unlock()
+
+	for _, data := range a.conn.published() {
+		var env model.Envelope
+		if json.Unmarshal(data, &env) == nil && strings.Contains(string(env.Payload), `"`+uid+`"`) && polls > a.delay {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestRunBench(t *testing.T) {
+	conn := &fakeConn{}
+	api := &fakeAPI{conn: conn, delay: 2, polls: make(map[string]int)}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	bench := benchOptions{
+		n: 10, concurrency: 4, apiURL: ts.URL, poll: time.Millisecond,
+		timeout: 5 * time.Second, seed: 1, apiKey: "bench-key",
+	}
+	var out strings.Builder
+	if err := runBench(NewPublisher(conn, "orders", 0), &options{format: "json"}, bench, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(conn.published()); got != 10 {
+		t.Errorf("опубликовано %d заказов", got)
+	}
+	for _, want := range []string{"заказов 10, доступны через API 10, не дождались 0", "p50=", "p95=", "p99=", "заказов/с"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("в отчете нет %q:\n%s", want, out.String())
+		}
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for uid, polls := range api.polls {
+		if polls != api.delay+1 {
+			t.Errorf("заказ %s опрошен %d раз", uid, polls)
+		}
+	}
+	for _, key := range api.auth {
+		if key != "bench-key" {
+			t.Fatalf("опрос без API-ключа: %q", key)
+		}
+	}
+}
+
+func TestWaitVisible(t *testing.T) {
+	var status atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer ts.Close()
+	bench := benchOptions{apiURL: ts.URL, poll: time.Millisecond, timeout: 50 * time.Millisecond}
+	client := ts.Client()
+
+	status.Store(http.StatusOK)
+	job := waitVisible(client, bench, visibility{uid: "a", published: time.Now()})
+	if job.err != nil || job.visible.IsZero() {
+		t.Errorf("доступный заказ: %+v", job)
+	}
+
+	// Отказ в доступе не ждет таймаута
+	status.Store(http.StatusUnauthorized)
+	start := time.Now()
+	job = waitVisible(client, bench, visibility{uid: "a", published: start})
+	if job.err == nil || !strings.Contains(job.err.Error(), "-api-key") || time.Since(start) >= bench.timeout {
+		t.Errorf("401: %v за %s", job.err, time.Since(start))
+	}
+
+	status.Store(http.StatusNotFound)
+	job = waitVisible(client, bench, visibility{uid: "a", published: time.Now()})
+	if job.err == nil || !job.visible.IsZero() {
+		t.Errorf("недоступный заказ: %+v", job)
+	}
+}
+
+func TestBenchRequest(t *testing.T) {
+	for _, tc := range []struct {
+		bench         benchOptions
+		key, authzHdr string
+	}{
+		{benchOptions{}, "", ""},
+		{benchOptions{apiKey: "k"}, "k", ""},
+		{benchOptions{token: "jwt"}, "", "Bearer jwt"},
+	} {
+		req := tc.bench.request("http://localhost/api/order/a")
+		if req.Header.Get("X-API-Key") != tc.key || req.Header.Get("Authorization") != tc.authzHdr {
+			t.Errorf("%+v: заголовки %v", tc.bench, req.Header)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"3":                             3 * time.Second,
+		"":                              time.Second,
+		"0":                             time.Second,
+		"Wed, 21 Oct 2026 07:28:00 GMT": time.Second,
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if header != "" {
+			resp.Header.Set("Retry-After", header)
+		}
+		if got := retryAfter(resp); got != want {
+			t.Errorf("Retry-After %q: %s, ожидалось %s", header, got, want)
+		}
+	}
+}
+
+func TestPrintBench(t *testing.T) {
+	start := time.Now()
+	var all []visibility
+	for i := 1; i <= 100; i++ {
+		all = append(all, visibility{
+			published: start,
+			visible:   start.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	all = append(all, visibility{published: start, err: errors.New("таймаут"), throttled: 3})
+
+	var out strings.Builder
+	printBench(&out, all)
+	for _, want := range []string{
+		"заказов 101, доступны через API 100, не дождались 1",
+		"Ответов 429 (лимит частоты запросов): 3",
+		"p50=50ms p95=95ms p99=99ms max=100ms",
+		// 100 заказов за 100 мс
+		"Пропускная способность: 1000.0 заказов/с",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("в отчете нет %q:\n%s", want, out.String())
+		}
+	}
+}
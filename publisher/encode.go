@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// encodeOrder сериализует заказ в JSON или protobuf и при необходимости
+// заворачивает его в конверт
+func encodeOrder(order *model.Order, format string, envelope bool) ([]byte, error) {
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.Marshal(order)
+	case "proto":
+		data, err = orderpb.Marshal(orderpb.FromModel(order))
+	default:
+		return nil, fmt.Errorf("неизвестный формат %q: ожидается json или proto", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации заказа (%s): %w", format, err)
+	}
+
+	if !envelope {
+		return data, nil
+	}
+
+	env := model.Envelope{
+		SchemaVersion: model.SchemaVersion,
+		EventType:     model.EventOrderCreated,
+		ProducedAt:    time.Now().UTC(),
+		Producer:      "test-publisher",
+		ContentType:   model.FormatJSON,
+		Payload:       data,
+	}
+	if format == "proto" {
+		// Бинарный protobuf передается в JSON-конверте строкой base64
+		env.ContentType = model.FormatProtobuf
+		env.Payload, _ = json.Marshal(base64.StdEncoding.EncodeToString(data))
+	}
+	if data, err = json.Marshal(env); err != nil {
+		return nil, fmt.Errorf("ошибка сериализации конверта: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// publishFile отправляет сообщения из файла как есть. Поддерживаются JSON-массив
+// сообщений и NDJSON (одно сообщение на строку, пустые строки пропускаются).
+func publishFile(p *Publisher, path string) error {
+	if path == "" {
+		return fmt.Errorf("не указан файл: -path")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	messages, err := splitMessages(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for i, msg := range messages {
+		p.Publish(fmt.Sprintf("%s:%d", path, i+1), msg)
+	}
+	return nil
+}
+
+// splitMessages разбивает содержимое файла на отдельные сообщения
+func splitMessages(data []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(trimmed, &arr); err != nil {
+			return nil, fmt.Errorf("ошибка разбора JSON-массива: %w", err)
+		}
+		messages := make([][]byte, len(arr))
+		for i, raw := range arr {
+			messages[i] = raw
+		}
+		return messages, nil
+	}
+
+	var messages [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		messages = append(messages, append([]byte(nil), line...))
+	}
+	return messages, scanner.Err()
+}
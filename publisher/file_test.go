@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{"JSON-массив", ` [{"a":1}, {"b":2}] `, []string{`{"a":1}`, `{"b":2}`}, false},
+		{"NDJSON", "{\"a\":1}\n\n  {\"b\":2}  \r\n", []string{`{"a":1}`, `{"b":2}`}, false},
+		{"одно сообщение", `{"a":1}`, []string{`{"a":1}`}, false},
+		{"пустой файл", "\n\n", nil, false},
+		{"битый массив", `[{"a":1},`, nil, true},
+	} {
+		messages, err := splitMessages([]byte(tc.data))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: ошибка %v", tc.name, err)
+			continue
+		}
+		var got []string
+		for _, m := range messages {
+			got = append(got, string(m))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: сообщения %q, ожидались %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPublishFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.ndjson")
+	if err := os.WriteFile(path, []byte("{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conn := &fakeConn{}
+	p := NewPublisher(conn, "orders", 0)
+	if err := publishFile(p, path); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	if got := conn.published(); len(got) != 3 || string(got[2]) != `{"n":3}` {
+		t.Errorf("опубликовано %q", got)
+	}
+
+	if err := publishFile(p, ""); err == nil {
+		t.Error("файл не указан, а ошибки нет")
+	}
+	if err := publishFile(p, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("нет ошибки для несуществующего файла")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"orders-service/model"
+)
+
+// sampleOrder — тестовый заказ из задания
+func sampleOrder() *model.Order {
+	return &model.Order{
+		OrderUID:    "b583feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: model.Delivery{
+			Name:    "Mikhail Moskovsky",
+			Phone:   "+79999999999",
+			Zip:     "2639809",
+			City:    "Moscow",
+			Address: "The Red Square",
+			Region:  "Central",
+			Email:   "Moskovsky@gmail.com",
+		},
+		Payment: model.Payment{
+			Transaction:  "b583feb7b2b84b6test",
+			RequestID:    "",
+			Currency:     "RUB",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "Sberbank",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+			CustomFee:    0,
+		},
+		Items: []model.Item{
+			{
+				ChrtID:      9934930,
+				TrackNumber: "WBILMTESTTRACK",
+				Price:       100000,
+				RID:         "ab4219087a764ae0btest",
+				Name:        "iPhone 17 pro",
+				Sale:        30,
+				Size:        "0",
+				TotalPrice:  70000,
+				NMID:        2389212,
+				Brand:       "Apple",
+				Status:      202,
+			},
+		},
+		Locale:            "en",
+		InternalSignature: "",
+		CustomerID:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SMID:              99,
+		DateCreated:       time.Now(),
+		OOFShard:          "1",
+	}
+}
+
+var (
+	firstNames = []string{"Mikhail", "Anna", "Ivan", "Olga", "Sergey", "Maria", "Dmitry", "Elena"}
+	lastNames  = []string{"Moskovsky", "Petrova", "Ivanov", "Smirnova", "Kuznetsov", "Popova"}
+	cities     = []struct{ city, region string }{
+		{"Moscow", "Central"}, {"Saint Petersburg", "Northwestern"}, {"Kazan", "Volga"},
+		{"Novosibirsk", "Siberian"}, {"Yekaterinburg", "Ural"}, {"Krasnodar", "Southern"},
+	}
+	products = []struct{ name, brand string }{
+		{"iPhone 17 pro", "Apple"}, {"Galaxy S25", "Samsung"}, {"Mascaras", "Vivienne Sabo"},
+		{"Sneakers", "Nike"}, {"Backpack", "Xiaomi"}, {"Headphones", "Sony"}, {"Kettle", "Bosch"},
+	}
+	banks            = []string{"Sberbank", "Alpha", "Tinkoff", "VTB"}
+	currencies       = []string{"RUB", "USD", "EUR"}
+	deliveryServices = []string{"meest", "cdek", "boxberry", "wb"}
+	locales          = []string{"ru", "en"}
+)
+
+// randomOrder генерирует случайный, но корректный заказ с номером n
+func randomOrder(rng *rand.Rand, n int) *model.Order {
+	uid := fmt.Sprintf("%016x%dgen", rng.Uint64(), n)
+	track := fmt.Sprintf("WBIL%010d", rng.Intn(1e10))
+	place := cities[rng.Intn(len(cities))]
+	first, last := firstNames[rng.Intn(len(firstNames))], lastNames[rng.Intn(len(lastNames))]
+
+	order := model.NewOrder(uid, track, fmt.Sprintf("customer-%d", rng.Intn(1000)))
+	order.Entry = "WBIL"
+	order.Locale = locales[rng.Intn(len(locales))]
+	order.DeliveryService = deliveryServices[rng.Intn(len(deliveryServices))]
+	order.Shardkey = fmt.Sprint(rng.Intn(10))
+	order.SMID = rng.Intn(100)
+	order.OOFShard = fmt.Sprint(rng.Intn(3))
+	order.DateCreated = time.Now().UTC().Add(-time.Duration(rng.Intn(30*24)) * time.Hour)
+	order.Delivery = model.Delivery{
+		Name:    first + " " + last,
+		Phone:   fmt.Sprintf("+79%09d", rng.Intn(1e9)),
+		Zip:     fmt.Sprintf("%06d", rng.Intn(1e6)),
+		City:    place.city,
+		Address: fmt.Sprintf("Lenina st. %d", rng.Intn(200)+1),
+		Region:  place.region,
+		Email:   strings.ToLower(first) + fmt.Sprintf("%d@example.com", rng.Intn(1000)),
+	}
+	order.Payment.Currency = currencies[rng.Intn(len(currencies))]
+	order.Payment.Provider = "wbpay"
+	order.Payment.Bank = banks[rng.Intn(len(banks))]
+	order.Payment.PaymentDt = order.DateCreated.Unix()
+	order.Payment.DeliveryCost = rng.Intn(2000)
+
+	for i := rng.Intn(4) + 1; i > 0; i-- {
+		product := products[rng.Intn(len(products))]
+		price := rng.Intn(100000) + 100
+		sale := rng.Intn(50)
+		order.AddItem(model.Item{
+			ChrtID:     rng.Intn(1e7),
+			Price:      price,
+			RID:        fmt.Sprintf("%016x", rng.Uint64()),
+			Name:       product.name,
+			Sale:       sale,
+			Size:       fmt.Sprint(rng.Intn(5)),
+			TotalPrice: price * (100 - sale) / 100,
+			NMID:       rng.Intn(1e7),
+			Brand:      product.brand,
+			Status:     202,
+		})
+	}
+	return order
+}
+
+// publishGenerated отправляет n случайных корректных заказов
+func publishGenerated(p *Publisher, opts *options, n int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		order := randomOrder(rng, i)
+		if err := order.Validate(); err != nil {
+			return fmt.Errorf("сгенерирован некорректный заказ: %w", err)
+		}
+		data, err := encodeOrder(order, opts.format, opts.envelope)
+		if err != nil {
+			return err
+		}
+		p.Publish(order.OrderUID, data)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+func TestRandomOrderIsValid(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	uids := make(map[string]bool)
+	for i := 0; i < 500; i++ {
+		order := randomOrder(rng, i)
+		if err := order.Validate(); err != nil {
+			t.Fatalf("заказ %d: %v", i, err)
+		}
+		if uids[order.OrderUID] {
+			t.Fatalf("повторный order_uid %s", order.OrderUID)
+		}
+		uids[order.OrderUID] = true
+		if len(order.Items) == 0 {
+			t.Errorf("заказ %s без товаров", order.OrderUID)
+		}
+	}
+
+	// Одно и то же зерно дает одни и те же заказы; даты отсчитываются от
+	// текущего момента и не сравниваются
+	a := randomOrder(rand.New(rand.NewSource(42)), 0)
+	b := randomOrder(rand.New(rand.NewSource(42)), 0)
+	for _, o := range []*model.Order{a, b} {
+		o.DateCreated, o.Payment.PaymentDt = time.Time{}, 0
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Error("заказы с одинаковым зерном различаются")
+	}
+	if err := sampleOrder().Validate(); err != nil {
+		t.Errorf("тестовый заказ: %v", err)
+	}
+}
+
+// decodeMessage разбирает сообщение publisher так, как его видит сервис
+func decodeMessage(t *testing.T, data []byte, format string, envelope bool) *model.Order {
+	t.Helper()
+	body := data
+	if envelope {
+		var env model.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.SchemaVersion != model.SchemaVersion || env.EventType != model.EventOrderCreated || env.ProducedAt.IsZero() {
+			t.Errorf("конверт %+v", env)
+		}
+		body = env.Payload
+		if format == "proto" {
+			if env.ContentType != model.FormatProtobuf {
+				t.Errorf("content_type %q", env.ContentType)
+			}
+			var encoded string
+			if err := json.Unmarshal(env.Payload, &encoded); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if format == "proto" {
+		pb, err := orderpb.Unmarshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pb.ToModel()
+	}
+	var order model.Order
+	if err := json.Unmarshal(body, &order); err != nil {
+		t.Fatal(err)
+	}
+	return &order
+}
+
+func TestEncodeOrder(t *testing.T) {
+	order := sampleOrder()
+	for _, format := range []string{"json", "proto"} {
+		for _, envelope := range []bool{false, true} {
+			data, err := encodeOrder(order, format, envelope)
+			if err != nil {
+				t.Fatalf("%s, конверт %v: %v", format, envelope, err)
+			}
+			got := decodeMessage(t, data, format, envelope)
+			if got.OrderUID != order.OrderUID || got.Payment != order.Payment || len(got.Items) != len(order.Items) {
+				t.Errorf("%s, конверт %v: заказ %+v", format, envelope, got)
+			}
+		}
+	}
+	if _, err := encodeOrder(order, "xml", false); err == nil {
+		t.Error("неизвестный формат принят")
+	}
+}
+
+func TestPublishGenerated(t *testing.T) {
+	conn := &fakeConn{}
+	p := NewPublisher(conn, "orders", 0)
+	opts := &options{format: "proto", envelope: true}
+	if err := publishGenerated(p, opts, 20, 7); err != nil {
+		t.Fatal(err)
+	}
+	if report := p.Wait(); report.Sent != 20 || report.Acked != 20 {
+		t.Errorf("отчет %+v", report)
+	}
+	for _, data := range conn.published() {
+		if err := decodeMessage(t, data, opts.format, opts.envelope).Validate(); err != nil {
+			t.Errorf("опубликован некорректный заказ: %v", err)
+		}
+	}
+}
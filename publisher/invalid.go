@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"orders-service/model"
+)
+
+// invalidKinds — заведомо некорректные сообщения для проверки отклонения
+// заказов сервисом. Каждая функция строит сообщение на основе тестового заказа.
+var invalidKinds = map[string]func() []byte{
+	// Сообщение не является ни JSON, ни protobuf-заказом
+	"bad-json": func() []byte {
+		return []byte(`{"order_uid": "broken`)
+	},
+	"missing-uid": func() []byte {
+		order := sampleOrder()
+		order.OrderUID = ""
+		return mustJSON(order)
+	},
+	// payment.transaction не совпадает с order_uid
+	"bad-transaction": func() []byte {
+		order := sampleOrder()
+		order.OrderUID = "invalid-transaction-test"
+		return mustJSON(order)
+	},
+	// Числовые поля переданы строками
+	"mistyped": func() []byte {
+		return withFields(map[string]any{"sm_id": "99", "payment": map[string]any{
+			"transaction": "b583feb7b2b84b6test", "amount": "1817",
+		}})
+	},
+	// Опечатка в имени поля: отклоняется только в строгом режиме
+	"unknown-fields": func() []byte {
+		return withFields(map[string]any{"trak_number": "WBILMTESTTRACK"})
+	},
+	// Версия схемы новее поддерживаемой сервисом
+	"future-version": func() []byte {
+		return mustJSON(model.Envelope{
+			SchemaVersion: model.SchemaVersion + 100,
+			EventType:     model.EventOrderCreated,
+			Producer:      "test-publisher",
+			Payload:       mustJSON(sampleOrder()),
+		})
+	},
+	"bad-event-type": func() []byte {
+		return mustJSON(model.Envelope{
+			SchemaVersion: model.SchemaVersion,
+			EventType:     "order.exploded",
+			Producer:      "test-publisher",
+			Payload:       mustJSON(sampleOrder()),
+		})
+	},
+	// Бинарные данные, которые не разбираются как protobuf
+	"bad-proto": func() []byte {
+		return []byte{0x0a, 0xff, 0xff, 0xff}
+	},
+}
+
+// publishInvalid отправляет n раз некорректное сообщение вида kind или всех видов
+func publishInvalid(p *Publisher, kind string, n int) error {
+	kinds := []string{kind}
+	if kind == "all" {
+		kinds = sortedKinds()
+	}
+
+	for _, k := range kinds {
+		build, ok := invalidKinds[k]
+		if !ok {
+			return fmt.Errorf("неизвестный вид некорректного сообщения %q: %s", k, invalidKindsHelp())
+		}
+		for i := 0; i < n; i++ {
+			p.Publish("invalid:"+k, build())
+		}
+	}
+	return nil
+}
+
+func sortedKinds() []string {
+	kinds := make([]string, 0, len(invalidKinds))
+	for k := range invalidKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func invalidKindsHelp() string {
+	return strings.Join(append(sortedKinds(), "all"), ", ")
+}
+
+// withFields возвращает тестовый заказ в JSON с замененными или добавленными полями
+func withFields(fields map[string]any) []byte {
+	var doc map[string]any
+	if err := json.Unmarshal(mustJSON(sampleOrder()), &doc); err != nil {
+		panic(err)
+	}
+	for k, v := range fields {
+		if nested, ok := v.(map[string]any); ok {
+			if target, ok := doc[k].(map[string]any); ok {
+				for nk, nv := range nested {
+					target[nk] = nv
+				}
+				continue
+			}
+		}
+		doc[k] = v
+	}
+	return mustJSON(doc)
+}
+
+func mustJSON(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
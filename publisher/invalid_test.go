@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"orders-service/model"
+	"orders-service/orderpb"
+)
+
+// invalidChecks проверяют, что сообщение каждого вида действительно
+// некорректно и именно так, как задумано
+var invalidChecks = map[string]func(data []byte) bool{
+	"bad-json": func(data []byte) bool { return !json.Valid(data) },
+	"missing-uid": func(data []byte) bool {
+		order, err := parseOrder(data, false)
+		return err == nil && order.OrderUID == "" && order.Validate() != nil
+	},
+	"bad-transaction": func(data []byte) bool {
+		order, err := parseOrder(data, false)
+		return err == nil && order.OrderUID != "" && order.Validate() != nil
+	},
+	"mistyped": func(data []byte) bool {
+		_, err := parseOrder(data, false)
+		return err != nil && json.Valid(data)
+	},
+	// Мягкий режим принимает заказ, строгий — отклоняет
+	"unknown-fields": func(data []byte) bool {
+		order, err := parseOrder(data, false)
+		_, strictErr := parseOrder(data, true)
+		return err == nil && order.Validate() == nil && strictErr != nil
+	},
+	"future-version": func(data []byte) bool {
+		var env model.Envelope
+		return json.Unmarshal(data, &env) == nil && env.SchemaVersion > model.SchemaVersion
+	},
+	"bad-event-type": func(data []byte) bool {
+		var env model.Envelope
+		return json.Unmarshal(data, &env) == nil && env.SchemaVersion == model.SchemaVersion &&
+			env.EventType != model.EventOrderCreated && env.EventType != model.EventOrderUpdated
+	},
+	"bad-proto": func(data []byte) bool {
+		_, err := orderpb.Unmarshal(data)
+		return err != nil && !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	},
+}
+
+// parseOrder разбирает JSON-заказ; strict отклоняет неизвестные поля
+func parseOrder(data []byte, strict bool) (*model.Order, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	var order model.Order
+	if err := dec.Decode(&order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func TestInvalidKinds(t *testing.T) {
+	for _, kind := range sortedKinds() {
+		check, ok := invalidChecks[kind]
+		if !ok {
+			t.Errorf("для вида %s нет проверки", kind)
+			continue
+		}
+		if !check(invalidKinds[kind]()) {
+			t.Errorf("%s: сообщение некорректно не так, как задумано: %s", kind, invalidKinds[kind]())
+		}
+	}
+}
+
+func TestPublishInvalid(t *testing.T) {
+	conn := &fakeConn{}
+	p := NewPublisher(conn, "orders", 0)
+	if err := publishInvalid(p, "all", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := publishInvalid(p, "bad-json", 1); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	if got, want := len(conn.published()), 2*len(invalidKinds)+1; got != want {
+		t.Errorf("опубликовано %d сообщений, ожидалось %d", got, want)
+	}
+	if err := publishInvalid(p, "no-such-kind", 1); err == nil {
+		t.Error("неизвестный вид принят")
+	}
+}
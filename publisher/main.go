@@ -0,0 +1,119 @@
+// Publisher — утилита для отправки заказов в NATS Streaming: тестовый заказ,
+// сгенерированная нагрузка, фикстуры из файла и заведомо некорректные сообщения.
+//
+// Использование:
+//
+//	go run . [one] [флаги]          отправить тестовый заказ b583feb7b2b84b6test
+//	go run . gen -n 1000 -rate 200  отправить N случайных корректных заказов
+//	go run . file -path orders.ndjson
+//	go run . invalid -kind all      отправить некорректные сообщения
+//	go run . bench -n 500 -concurrency 16  замерить задержку от публикации до API
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// options — общие флаги всех подкоманд
+type options struct {
+	clusterID string
+	clientID  string
+	natsURL   string
+	channel   string
+	format    string
+	envelope  bool
+	rate      float64
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.clusterID, "cluster", "test-cluster", "ID кластера NATS Streaming")
+	fs.StringVar(&o.clientID, "client", fmt.Sprintf("test-publisher-%d", os.Getpid()), "ID клиента NATS Streaming")
+	fs.StringVar(&o.natsURL, "url", "nats://localhost:4222", "адрес NATS")
+	fs.StringVar(&o.channel, "channel", "orders", "канал для публикации")
+	fs.StringVar(&o.format, "format", "json", "формат сообщения: json или proto")
+	fs.BoolVar(&o.envelope, "envelope", false, "завернуть заказ в конверт с версией схемы")
+	fs.Float64Var(&o.rate, "rate", 0, "целевая скорость, сообщений в секунду (0 — без ограничения)")
+}
+
+func main() {
+	cmd, args := "one", os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	var opts options
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	opts.register(fs)
+
+	var run func(p *Publisher) error
+	switch cmd {
+	case "one":
+		run = func(p *Publisher) error { return publishOne(p, &opts) }
+	case "gen":
+		n := fs.Int("n", 100, "количество заказов")
+		seed := fs.Int64("seed", time.Now().UnixNano(), "зерно генератора случайных заказов")
+		run = func(p *Publisher) error { return publishGenerated(p, &opts, *n, *seed) }
+	case "file":
+		path := fs.String("path", "", "JSON- или NDJSON-файл с сообщениями")
+		run = func(p *Publisher) error { return publishFile(p, *path) }
+	case "bench":
+		var bench benchOptions
+		fs.IntVar(&bench.n, "n", 100, "количество заказов")
+		fs.IntVar(&bench.concurrency, "concurrency", 8, "число параллельных опрашивающих API")
+		fs.StringVar(&bench.apiURL, "api", "http://localhost:8080", "адрес HTTP API сервиса")
+		// 8 опрашивающих раз в 200 мс укладываются в лимит чтения по умолчанию (50 запросов/с)
+		fs.DurationVar(&bench.poll, "poll", 200*time.Millisecond, "интервал опроса API")
+		fs.DurationVar(&bench.timeout, "timeout", 30*time.Second, "сколько ждать появления заказа")
+		fs.Int64Var(&bench.seed, "seed", time.Now().UnixNano(), "зерно генератора случайных заказов")
+		fs.StringVar(&bench.apiKey, "api-key", os.Getenv("ORDERS_API_KEY"), "API-ключ сервиса (X-API-Key)")
+		fs.StringVar(&bench.token, "token", os.Getenv("ORDERS_TOKEN"), "JWT для заголовка Authorization: Bearer")
+		run = func(p *Publisher) error { return runBench(p, &opts, bench, os.Stdout) }
+	case "invalid":
+		kind := fs.String("kind", "all", "вид некорректного сообщения: "+invalidKindsHelp())
+		n := fs.Int("n", 1, "сколько раз отправить каждое сообщение")
+		run = func(p *Publisher) error { return publishInvalid(p, *kind, *n) }
+	default:
+		log.Fatalf("Неизвестная команда %q: ожидается one, gen, file, invalid или bench", cmd)
+	}
+	fs.Parse(args)
+
+	sc, err := stan.Connect(opts.clusterID, opts.clientID, stan.NatsURL(opts.natsURL))
+	if err != nil {
+		log.Fatalf("Ошибка подключения к NATS: %v", err)
+	}
+	defer sc.Close()
+
+	log.Println("Подключено к NATS Streaming")
+
+	p := NewPublisher(sc, opts.channel, opts.rate)
+	if err := run(p); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	report := p.Wait()
+	report.Print(os.Stdout)
+	if report.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// publishOne отправляет тестовый заказ b583feb7b2b84b6test
+func publishOne(p *Publisher, opts *options) error {
+	order := sampleOrder()
+	if err := order.Validate(); err != nil {
+		return fmt.Errorf("тестовый заказ не проходит валидацию: %w", err)
+	}
+
+	data, err := encodeOrder(order, opts.format, opts.envelope)
+	if err != nil {
+		return err
+	}
+	p.Publish(order.OrderUID, data)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// Publisher публикует сообщения асинхронно с заданной скоростью и собирает
+// задержку до подтверждения (ack) сервером NATS Streaming и ошибки публикации
+type Publisher struct {
+	sc      stan.Conn
+	channel string
+	ticker  *time.Ticker
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	started time.Time
+	report  Report
+}
+
+// NewPublisher создает публикатор в канал channel. rate — целевая скорость
+// в сообщениях в секунду, 0 — без ограничения.
+func NewPublisher(sc stan.Conn, channel string, rate float64) *Publisher {
+	p := &Publisher{sc: sc, channel: channel}
+	if rate > 0 {
+		p.ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+	}
+	return p
+}
+
+// Publish отправляет сообщение, не дожидаясь подтверждения, и возвращает
+// момент отправки. id используется только в логах.
+func (p *Publisher) Publish(id string, data []byte) time.Time {
+	if p.ticker != nil {
+		<-p.ticker.C
+	}
+
+	p.mu.Lock()
+	if p.started.IsZero() {
+		p.started = time.Now()
+	}
+	p.report.Sent++
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	sent := time.Now()
+	_, err := p.sc.PublishAsync(p.channel, data, func(_ string, err error) {
+		defer p.wg.Done()
+		p.ack(id, sent, err)
+	})
+	if err != nil {
+		p.wg.Done()
+		p.ack(id, sent, err)
+	}
+	return sent
+}
+
+func (p *Publisher) ack(id string, sent time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.report.Errors++
+		log.Printf("Ошибка публикации %s: %v", id, err)
+		return
+	}
+	p.report.Acked++
+	p.report.Latencies = append(p.report.Latencies, time.Since(sent))
+}
+
+// Wait дожидается подтверждений всех отправленных сообщений и возвращает отчет
+func (p *Publisher) Wait() Report {
+	p.wg.Wait()
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.started.IsZero() {
+		p.report.Elapsed = time.Since(p.started)
+	}
+	return p.report
+}
+
+// Report — итоги публикации
+type Report struct {
+	Sent      int
+	Acked     int
+	Errors    int
+	Elapsed   time.Duration
+	Latencies []time.Duration
+}
+
+// Print выводит отчет: количество, скорость и перцентили задержки подтверждения
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Отправлено: %d, подтверждено: %d, ошибок: %d\n", r.Sent, r.Acked, r.Errors)
+	if r.Elapsed > 0 {
+		fmt.Fprintf(w, "Время: %s, скорость: %.1f сообщ./с\n",
+			r.Elapsed.Round(time.Millisecond), float64(r.Acked)/r.Elapsed.Seconds())
+	}
+	if len(r.Latencies) == 0 {
+		return
+	}
+
+	lat := append([]time.Duration(nil), r.Latencies...)
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	fmt.Fprintf(w, "Задержка ack: p50=%s p95=%s p99=%s max=%s\n",
+		percentile(lat, 50), percentile(lat, 95), percentile(lat, 99), lat[len(lat)-1])
+}
+
+// percentile возвращает перцентиль p отсортированной выборки
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx].Round(time.Microsecond)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// fakeConn — соединение NATS Streaming без сервера: запоминает сообщения и
+// подтверждает их асинхронно. fail задает ошибку подтверждения сообщения.
+type fakeConn struct {
+	stan.Conn
+	fail func(data []byte) error
+
+	mu       sync.Mutex
+	channel  string
+	messages [][]byte
+}
+
+func (c *fakeConn) PublishAsync(channel string, data []byte, ah stan.AckHandler) (string, error) {
+	c.mu.Lock()
+	c.channel = channel
+	c.messages = append(c.messages, data)
+	c.mu.Unlock()
+
+	var err error
+	if c.fail != nil {
+		err = c.fail(data)
+	}
+	go ah("guid", err)
+	return "guid", nil
+}
+
+// published возвращает отправленные сообщения
+func (c *fakeConn) published() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.messages...)
+}
+
+func TestPublisherReport(t *testing.T) {
+	conn := &fakeConn{fail: func(data []byte) error {
+		if bytes.HasPrefix(data, []byte("bad")) {
+			return errors.New("нет подтверждения")
+		}
+		return nil
+	}}
+	p := NewPublisher(conn, "orders", 0)
+	for _, msg := range []string{"ok-1", "bad-1", "ok-2", "ok-3"} {
+		p.Publish(msg, []byte(msg))
+	}
+	report := p.Wait()
+
+	if conn.channel != "orders" || len(conn.published()) != 4 {
+		t.Errorf("канал %q, сообщений %d", conn.channel, len(conn.published()))
+	}
+	if report.Sent != 4 || report.Acked != 3 || report.Errors != 1 || len(report.Latencies) != 3 {
+		t.Errorf("отчет %+v", report)
+	}
+
+	var out strings.Builder
+	report.Print(&out)
+	for _, want := range []string{"Отправлено: 4, подтверждено: 3, ошибок: 1", "p50=", "p99="} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("в отчете нет %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPublisherRate(t *testing.T) {
+	p := NewPublisher(&fakeConn{}, "orders", 100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		p.Publish("order", []byte("{}"))
+	}
+	p.Wait()
+	// 5 сообщений со скоростью 100/с занимают не меньше 50 мс
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("5 сообщений отправлены за %s при скорости 100/с", elapsed)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+		{0, time.Millisecond},
+	} {
+		if got := percentile(sorted, tc.p); got != tc.want {
+			t.Errorf("p%v = %s, ожидалось %s", tc.p, got, tc.want)
+		}
+	}
+	if got := percentile([]time.Duration{7 * time.Millisecond}, 99); got != 7*time.Millisecond {
+		t.Errorf("одно значение: %s", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("пустая выборка: %s", got)
+	}
+}
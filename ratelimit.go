@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Группы маршрутов с общими лимитами запросов
+const (
+	RouteGroupRead  = "read"
+	RouteGroupWrite = "write"
+	RouteGroupAdmin = "admin"
+	// RouteGroupAuth — неудачные попытки аутентификации с одного IP-адреса.
+	// Пока корзина пуста, запросы с этого адреса отклоняются до проверки
+	// учетных данных, поэтому подбирать ключи и токены нельзя.
+	RouteGroupAuth = "auth"
+)
+
+// maxAdminBody — максимальный размер тела административных запросов
+const maxAdminBody = 64 << 10
+
+func init() {
+	metrics.Describe("http_rate_limited_total", "Запросы, отклоненные ограничением частоты, по группам маршрутов")
+}
+
+// Limit — скорость пополнения корзины (запросов в секунду) и ее емкость
+// (допустимый всплеск). Нулевая скорость отключает ограничение.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit разбирает лимит вида "20:40" (20 запросов в секунду, всплеск до 40)
+// или "20" (всплеск равен скорости). "0" отключает ограничение.
+func ParseLimit(s string) (Limit, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 {
+		return Limit{}, fmt.Errorf("некорректный лимит %q: ожидается скорость[:всплеск]", s)
+	}
+	burst := int(math.Ceil(rate))
+	if hasBurst {
+		if burst, err = strconv.Atoi(burstStr); err != nil || burst < 1 {
+			return Limit{}, fmt.Errorf("некорректный всплеск в лимите %q", s)
+		}
+	}
+	return Limit{Rate: rate, Burst: max(burst, 1)}, nil
+}
+
+// bucket — корзина токенов одного клиента в одной группе маршрутов
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter ограничивает частоту запросов алгоритмом token bucket отдельно
+// для каждого клиента и группы маршрутов
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]Limit
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewRateLimiter создает ограничитель с лимитами по группам маршрутов
+func NewRateLimiter(limits map[string]Limit) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Wait возвращает, через сколько у клиента key в группе group появится
+// токен; 0 — токен есть. В отличие от Allow, токен не списывается.
+func (l *RateLimiter) Wait(group, key string) time.Duration {
+	limit, ok := l.limits[group]
+	if !ok || limit.Rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[group+"|"+key]
+	if !ok {
+		return 0
+	}
+	tokens := math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+}
+
+// Allow списывает токен клиента key в группе group. Если токенов нет,
+// возвращает false и время, через которое появится следующий.
+func (l *RateLimiter) Allow(group, key string) (bool, time.Duration) {
+	limit, ok := l.limits[group]
+	if !ok || limit.Rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	id := group + "|" + key
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[id] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep раз в минуту удаляет корзины, которые успели наполниться целиком:
+// они ничем не отличаются от новых
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for id, b := range l.buckets {
+		group, _, _ := strings.Cut(id, "|")
+		limit := l.limits[group]
+		if b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// clientKey определяет клиента: аутентифицированного — по учетной записи,
+// остальных — по IP-адресу
+func (s *Server) clientKey(r *http.Request) string {
+	if s.auth != nil {
+		if p := principalFrom(r.Context()); p != anonymous {
+			return "sub:" + p.Subject
+		}
+	}
+	return s.clientIP(r)
+}
+
+// clientIP возвращает ключ клиента по IP-адресу. Если запрос пришел от
+// доверенного прокси (SetTrustedProxies), адрес берется из X-Forwarded-For:
+// крайний правый, не принадлежащий доверенным прокси. Адреса левее него мог
+// подставить сам клиент.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !s.trustedProxy(addr) {
+		return "ip:" + host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Испорченный адрес добавлен до доверенного прокси: клиентом
+			// считается последний прокси, к которому он подключился
+			break
+		}
+		addr = hop.Unmap()
+		if !s.trustedProxy(addr) {
+			break
+		}
+	}
+	return "ip:" + addr.String()
+}
+
+// trustedProxy сообщает, принадлежит ли адрес доверенному прокси
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// limit ограничивает частоту запросов к маршрутам группы group
+func (s *Server) limit(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter != nil {
+			if ok, wait := s.limiter.Allow(group, s.clientKey(r)); !ok {
+				rateLimited(w, r, group, wait)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// rateLimited отвечает 429 с Retry-After
+func rateLimited(w http.ResponseWriter, r *http.Request, group string, wait time.Duration) {
+	retry := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	metrics.Inc("http_rate_limited_total", "group", group)
+	writeProblem(w, r, http.StatusTooManyRequests, CodeRateLimited, "")
+}
+
+// guard — общая обвязка маршрутов API: проверка прав (неудачные попытки
+// ограничиваются по IP-адресу в require), ограничение частоты запросов и
+// размера тела для группы маршрутов
+func (s *Server) guard(perm Permission, group string, next http.HandlerFunc) http.HandlerFunc {
+	return s.require(perm, s.limit(group, s.limitBody(group, next)))
+}
+
+// limitBody ограничивает размер тела запроса группы: write — SetLimits,
+// admin — maxAdminBody. Обработчик получает *http.MaxBytesError при чтении
+// сверх лимита.
+func (s *Server) limitBody(group string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch group {
+		case RouteGroupWrite:
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+		case RouteGroupAdmin:
+			r.Body = http.MaxBytesReader(w, r.Body, maxAdminBody)
+		}
+		next(w, r)
+	}
+}
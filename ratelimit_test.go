@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(map[string]Limit{RouteGroupRead: {Rate: 2, Burst: 3}})
+	for i := range 3 {
+		if ok, _ := l.Allow(RouteGroupRead, "a"); !ok {
+			t.Fatalf("запрос %d в пределах всплеска отклонен", i+1)
+		}
+	}
+	ok, wait := l.Allow(RouteGroupRead, "a")
+	if ok || wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("пустая корзина: ok=%v, wait=%s", ok, wait)
+	}
+
+	// Прошла секунда: при скорости 2 в секунду появилось два токена
+	l.mu.Lock()
+	l.buckets[RouteGroupRead+"|a"].last = time.Now().Add(-time.Second)
+	l.mu.Unlock()
+	if w := l.Wait(RouteGroupRead, "a"); w != 0 {
+		t.Errorf("Wait после пополнения: %s", w)
+	}
+	for i := range 2 {
+		if ok, _ := l.Allow(RouteGroupRead, "a"); !ok {
+			t.Errorf("токен %d после пополнения не выдан", i+1)
+		}
+	}
+	if ok, _ := l.Allow(RouteGroupRead, "a"); ok {
+		t.Error("выдано больше токенов, чем накопилось")
+	}
+
+	// Корзина не наполняется сверх емкости
+	l.mu.Lock()
+	l.buckets[RouteGroupRead+"|a"].last = time.Now().Add(-time.Hour)
+	l.mu.Unlock()
+	allowed := 0
+	for range 10 {
+		if ok, _ := l.Allow(RouteGroupRead, "a"); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("после долгого простоя выдано %d токенов, ожидалось 3", allowed)
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "key-a:viewer,key-b:viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetAuthenticator(auth)
+	s.SetLimits(NewRateLimiter(map[string]Limit{RouteGroupRead: {Rate: 0.5, Burst: 1}}), 1<<20)
+
+	get := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/order/missing", nil)
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := get("key-a"); rec.Code != http.StatusNotFound {
+		t.Fatalf("первый запрос: статус %d", rec.Code)
+	}
+	rec := get("key-a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("второй запрос: статус %d, ожидался 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After %q, ожидалось 2", got)
+	}
+	var problem map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil || problem["status"] != float64(http.StatusTooManyRequests) {
+		t.Errorf("тело 429: %v, %v", problem, err)
+	}
+
+	// У другого ключа своя корзина
+	if rec := get("key-b"); rec.Code != http.StatusNotFound {
+		t.Errorf("другой ключ: статус %d", rec.Code)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseNetworks("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseNetworks("10.0.0.0/8,proxy.local"); err == nil {
+		t.Error("имя хоста принято как доверенный прокси")
+	}
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetTrustedProxies(proxies)
+
+	for _, tc := range []struct {
+		name, remote string
+		xff          []string
+		want         string
+	}{
+		{"без прокси", "203.0.113.5:1234", nil, "ip:203.0.113.5"},
+		{"недоверенный адрес подставил X-Forwarded-For", "203.0.113.5:1234", []string{"198.51.100.1"}, "ip:203.0.113.5"},
+		{"доверенный прокси", "10.0.0.1:80", []string{"198.51.100.1"}, "ip:198.51.100.1"},
+		{"клиент подставил адрес перед прокси", "10.0.0.1:80", []string{"1.2.3.4, 198.51.100.1"}, "ip:198.51.100.1"},
+		{"цепочка доверенных прокси", "10.0.0.1:80", []string{"198.51.100.1, 192.168.1.10", "10.2.3.4"}, "ip:198.51.100.1"},
+		{"все адреса доверенные", "10.0.0.1:80", []string{"10.9.9.9"}, "ip:10.9.9.9"},
+		{"испорченный адрес", "10.0.0.1:80", []string{"1.2.3.4, garbage"}, "ip:10.0.0.1"},
+		{"без заголовка", "192.168.1.10:80", nil, "ip:192.168.1.10"},
+		{"IPv4 в IPv6", "[::ffff:10.0.0.1]:80", []string{"198.51.100.1"}, "ip:198.51.100.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, v := range tc.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := s.clientIP(r); got != tc.want {
+			t.Errorf("%s: %s, ожидалось %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimitByForwardedClient(t *testing.T) {
+	proxies, _ := ParseNetworks("10.0.0.0/8")
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetTrustedProxies(proxies)
+	s.SetLimits(NewRateLimiter(map[string]Limit{RouteGroupRead: {Rate: 0.1, Burst: 1}}), 1<<20)
+
+	get := func(client string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/order/missing", nil)
+		r.RemoteAddr = "10.0.0.1:80"
+		r.Header.Set("X-Forwarded-For", client)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	// Клиенты за одним прокси ограничиваются по отдельности
+	if get("198.51.100.1") != http.StatusNotFound || get("198.51.100.2") != http.StatusNotFound {
+		t.Fatal("первые запросы разных клиентов отклонены")
+	}
+	if code := get("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("повторный запрос клиента: статус %d, ожидался 429", code)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultPIIFields — поля доставки, которые маскируются по умолчанию
+const defaultPIIFields = "name,phone,email,address"
+
+// piiFields — поля доставки, которые можно маскировать, и способ маскирования
+var piiFields = map[string]struct {
+	mask func(string) string
+	ref  func(*Delivery) *string
+}{
+	"name":    {maskWords, func(d *Delivery) *string { return &d.Name }},
+	"phone":   {maskPhone, func(d *Delivery) *string { return &d.Phone }},
+	"email":   {maskEmail, func(d *Delivery) *string { return &d.Email }},
+	"address": {maskPrefix, func(d *Delivery) *string { return &d.Address }},
+	"zip":     {maskPrefix, func(d *Delivery) *string { return &d.Zip }},
+	"city":    {maskPrefix, func(d *Delivery) *string { return &d.City }},
+	"region":  {maskPrefix, func(d *Delivery) *string { return &d.Region }},
+}
+
+// Redactor маскирует персональные данные покупателя в ответах API для
+// пользователей без права PermPII
+type Redactor struct {
+	fields []string
+}
+
+// NewRedactor создает маскировщик для полей через запятую, например
+// "name,phone,email,address". Пустая строка отключает маскирование.
+func NewRedactor(fields string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, ok := piiFields[field]; !ok {
+			return nil, fmt.Errorf("неизвестное поле персональных данных %q", field)
+		}
+		r.fields = append(r.fields, field)
+	}
+	return r, nil
+}
+
+// Masks сообщает, маскируется ли поле доставки field
+func (r *Redactor) Masks(field string) bool {
+	return slices.Contains(r.fields, field)
+}
+
+// Redact возвращает копию заказа с замаскированными полями. Исходный заказ
+// (он может лежать в кэше) не изменяется.
+func (r *Redactor) Redact(order *Order) *Order {
+	if len(r.fields) == 0 {
+		return order
+	}
+	masked := *order
+	for _, field := range r.fields {
+		f := piiFields[field]
+		value := f.ref(&masked.Delivery)
+		*value = f.mask(*value)
+	}
+	return &masked
+}
+
+// present готовит заказ к выдаче пользователю запроса. Все обработчики,
+// отдающие заказы, должны пропускать их через present или presentAll.
+func (s *Server) present(r *http.Request, order *Order) *Order {
+	if principalFrom(r.Context()).Can(PermPII) {
+		return order
+	}
+	return s.redactor.Redact(order)
+}
+
+// presentAll — present для списка заказов
+func (s *Server) presentAll(r *http.Request, orders []*Order) []*Order {
+	if principalFrom(r.Context()).Can(PermPII) {
+		return orders
+	}
+	presented := make([]*Order, len(orders))
+	for i, order := range orders {
+		presented[i] = s.redactor.Redact(order)
+	}
+	return presented
+}
+
+// maskPhone оставляет код страны с оператором и последние цифры: +7999***9999
+func maskPhone(phone string) string {
+	if utf8.RuneCountInString(phone) < 10 {
+		return maskPrefix(phone)
+	}
+	runes := []rune(phone)
+	return string(runes[:5]) + "***" + string(runes[len(runes)-4:])
+}
+
+// maskEmail оставляет первую букву и домен: m***@gmail.com
+func maskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return maskPrefix(email)
+	}
+	return maskPrefix(local) + "@" + domain
+}
+
+// maskWords оставляет первую букву каждого слова: M*** M***
+func maskWords(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = maskPrefix(w)
+	}
+	return strings.Join(words, " ")
+}
+
+// maskPrefix оставляет только первый символ
+func maskPrefix(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return string(r) + "***"
+}
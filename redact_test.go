@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPIIMaskFieldsEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env, want string
+	}{
+		{"", defaultPIIFields},
+		{"off", ""},
+		{"phone,city", "phone,city"},
+	} {
+		t.Setenv("PII_MASK_FIELDS", tc.env)
+		if got := piiMaskFields(); got != tc.want {
+			t.Errorf("PII_MASK_FIELDS=%q: поля %q, ожидались %q", tc.env, got, tc.want)
+		}
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	for _, tc := range []struct {
+		fields  string
+		want    []string
+		wantErr bool
+	}{
+		{defaultPIIFields, []string{"name", "phone", "email", "address"}, false},
+		{" phone , city,,", []string{"phone", "city"}, false},
+		{"", nil, false},
+		{"zip,region", []string{"zip", "region"}, false},
+		{"passport", nil, true},
+		{"Phone", nil, true},
+		{"name;phone", nil, true},
+	} {
+		r, err := NewRedactor(tc.fields)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: ошибка %v", tc.fields, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(r.fields, tc.want) {
+			t.Errorf("%q: поля %v, ожидались %v", tc.fields, r.fields, tc.want)
+		}
+	}
+}
+
+func TestRedactPerField(t *testing.T) {
+	order := testOrder(t)
+	want := map[string]string{
+		"name":    "T*** T***",
+		"phone":   "+9720***0000",
+		"email":   "t***@gmail.com",
+		"address": "P***",
+		"zip":     "2***",
+		"city":    "K***",
+		"region":  "K***",
+	}
+	if len(want) != len(piiFields) {
+		t.Fatalf("проверяются %d полей из %d", len(want), len(piiFields))
+	}
+
+	for field, masked := range want {
+		r, err := NewRedactor(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := r.Redact(order)
+		if value := *piiFields[field].ref(&got.Delivery); value != masked {
+			t.Errorf("%s: %q, ожидалось %q", field, value, masked)
+		}
+		// Остальные поля не меняются
+		expected := order.Delivery
+		*piiFields[field].ref(&expected) = masked
+		if got.Delivery != expected {
+			t.Errorf("%s: изменены другие поля: %+v", field, got.Delivery)
+		}
+	}
+
+	// Заказ из кэша не изменяется
+	if fresh := testOrder(t); order.Delivery != fresh.Delivery {
+		t.Errorf("исходный заказ изменен: %+v", order.Delivery)
+	}
+	// Без полей маскирования заказ отдается как есть
+	off, _ := NewRedactor("")
+	if off.Redact(order) != order {
+		t.Error("пустой маскировщик скопировал заказ")
+	}
+}
+
+func TestMaskFunctions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mask     func(string) string
+		in, want string
+	}{
+		{"короткий телефон", maskPhone, "12345", "1***"},
+		{"телефон", maskPhone, "+79991234567", "+7999***4567"},
+		{"email без @", maskEmail, "test.gmail.com", "t***"},
+		{"email", maskEmail, "мария@почта.рф", "м***@почта.рф"},
+		{"несколько слов", maskWords, "  Мария   Иванова ", "М*** И***"},
+		{"пустое значение", maskPrefix, "", ""},
+		{"кириллица", maskPrefix, "Москва", "М***"},
+	} {
+		if got := tc.mask(tc.in); got != tc.want {
+			t.Errorf("%s: %q → %q, ожидалось %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactionByRole(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "viewer-key:viewer,support-key:support,admin-key:admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor, err := NewRedactor("phone,city")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := testOrder(t)
+	cache := NewOrderCache()
+	cache.Set(order.OrderUID, order)
+	s := NewServer(cache, nil, nil)
+	s.SetAuthenticator(auth)
+	s.SetRedactor(redactor)
+
+	for _, tc := range []struct {
+		key    string
+		masked bool
+	}{
+		{"viewer-key", true},
+		{"support-key", false},
+		{"admin-key", false},
+	} {
+		for _, path := range []string{"/api/order/" + order.OrderUID, "/api/orders"} {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("X-API-Key", tc.key)
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s: статус %d", tc.key, path, rec.Code)
+			}
+
+			var got Order
+			if path == "/api/orders" {
+				var list OrderList
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Orders) != 1 {
+					t.Fatalf("%s %s: %v, %s", tc.key, path, err, rec.Body)
+				}
+				got = *list.Orders[0]
+			} else if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			want := order.Delivery
+			if tc.masked {
+				want.Phone, want.City = maskPhone(want.Phone), maskPrefix(want.City)
+			}
+			if got.Delivery != want {
+				t.Errorf("%s %s: доставка %+v, ожидалась %+v", tc.key, path, got.Delivery, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// ReencryptReport — итог перешифрования персональных данных
+type ReencryptReport struct {
+	// Rewrapped — строки, ключ данных которых перешифрован активным KEK
+	Rewrapped int
+	// Encrypted — строки, хранившиеся открыто и теперь зашифрованные
+	Encrypted int
+}
+
+// add учитывает обработанную строку
+func (r *ReencryptReport) add(encrypted bool) {
+	if encrypted {
+		r.Encrypted++
+	} else {
+		r.Rewrapped++
+	}
+}
+
+// ReencryptPII переводит строки delivery и dead_letters на активный ключ
+// набора (SetKeyring). У строк, зашифрованных прежними KEK, перешифровывается
+// только ключ данных, сами поля не меняются; открытые строки шифруются.
+// Каждая строка обрабатывается в отдельной транзакции, поэтому команду можно
+// прервать и запустить повторно.
+func (db *DB) ReencryptPII(ctx context.Context) (ReencryptReport, error) {
+	var report ReencryptReport
+	rows, err := db.pool.Query(ctx,
+		`SELECT order_uid FROM delivery WHERE pii_key_id IS DISTINCT FROM $1 ORDER BY order_uid`,
+		db.keyring.Active())
+	if err != nil {
+		return report, fmt.Errorf("ошибка выбора строк для перешифрования: %w", err)
+	}
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("ошибка чтения order_uid: %w", err)
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("ошибка выбора строк для перешифрования: %w", err)
+	}
+	for _, uid := range uids {
+		encrypted, err := db.reencryptDelivery(ctx, uid)
+		if err != nil {
+			return report, err
+		}
+		report.add(encrypted)
+	}
+
+	rows, err = db.pool.Query(ctx,
+		`SELECT id FROM dead_letters WHERE pii_key_id IS DISTINCT FROM $1 ORDER BY id`,
+		db.keyring.Active())
+	if err != nil {
+		return report, fmt.Errorf("ошибка выбора недоставленных сообщений для перешифрования: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("ошибка чтения id недоставленного сообщения: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("ошибка выбора недоставленных сообщений для перешифрования: %w", err)
+	}
+	for _, id := range ids {
+		encrypted, err := db.reencryptDeadLetter(ctx, id)
+		if err != nil {
+			return report, err
+		}
+		report.add(encrypted)
+	}
+	return report, nil
+}
+
+// reencryptDelivery переводит одну строку delivery на активный ключ.
+// Возвращает true, если строка хранилась открыто.
+func (db *DB) reencryptDelivery(ctx context.Context, uid string) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var d Delivery
+	var keyID *string
+	var wrappedDEK []byte
+	err = tx.QueryRow(ctx, `
+		SELECT name, phone, zip, city, address, region, email, pii_key_id, pii_dek
+		FROM delivery WHERE order_uid = $1 FOR UPDATE`, uid).Scan(
+		&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email, &keyID, &wrappedDEK)
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения доставки заказа %s: %w", uid, err)
+	}
+
+	active := db.keyring.Active()
+	if keyID == nil {
+		sealed, newKeyID, newDEK, err := db.sealDelivery(uid, d)
+		if err != nil {
+			return false, fmt.Errorf("ошибка шифрования доставки заказа %s: %w", uid, err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE delivery SET name = $2, phone = $3, email = $4, address = $5,
+				pii_key_id = $6, pii_dek = $7
+			WHERE order_uid = $1`,
+			uid, sealed.Name, sealed.Phone, sealed.Email, sealed.Address, newKeyID, newDEK)
+		if err != nil {
+			return false, fmt.Errorf("ошибка сохранения доставки заказа %s: %w", uid, err)
+		}
+	} else if *keyID != active {
+		rewrapped, err := db.keyring.RewrapDEK(*keyID, uid, wrappedDEK)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(ctx, `UPDATE delivery SET pii_key_id = $2, pii_dek = $3 WHERE order_uid = $1`,
+			uid, active, rewrapped)
+		if err != nil {
+			return false, fmt.Errorf("ошибка сохранения ключа данных заказа %s: %w", uid, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return keyID == nil, nil
+}
+
+// reencryptDeadLetter переводит одно недоставленное сообщение на активный
+// ключ. Возвращает true, если сообщение хранилось открыто.
+func (db *DB) reencryptDeadLetter(ctx context.Context, id int64) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var payload, wrappedDEK []byte
+	var keyID *string
+	err = tx.QueryRow(ctx, `SELECT payload, pii_key_id, pii_dek FROM dead_letters WHERE id = $1 FOR UPDATE`,
+		id).Scan(&payload, &keyID, &wrappedDEK)
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения недоставленного сообщения %d: %w", id, err)
+	}
+
+	active := db.keyring.Active()
+	if keyID == nil {
+		sealed, newKeyID, newDEK, err := db.sealPayload(payload)
+		if err != nil {
+			return false, fmt.Errorf("ошибка шифрования недоставленного сообщения %d: %w", id, err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE dead_letters SET payload = $2, pii_key_id = $3, pii_dek = $4 WHERE id = $1`,
+			id, sealed, newKeyID, newDEK)
+		if err != nil {
+			return false, fmt.Errorf("ошибка сохранения недоставленного сообщения %d: %w", id, err)
+		}
+	} else if *keyID != active {
+		rewrapped, err := db.keyring.RewrapDEK(*keyID, deadLetterBinding, wrappedDEK)
+		if err != nil {
+			return false, fmt.Errorf("недоставленное сообщение %d: %w", id, err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE dead_letters SET pii_key_id = $2, pii_dek = $3 WHERE id = $1`,
+			id, active, rewrapped)
+		if err != nil {
+			return false, fmt.Errorf("ошибка сохранения ключа данных сообщения %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return keyID == nil, nil
+}
+
+// runReencrypt выполняет команду reencrypt и пишет итог в лог
+func runReencrypt(db *DB) error {
+	if db.keyring == nil {
+		return fmt.Errorf("ключи шифрования не заданы: PII_KEY_FILE или PII_KEYS")
+	}
+	log.Printf("Перешифрование персональных данных ключом %q...", db.keyring.Active())
+	report, err := db.ReencryptPII(context.Background())
+	log.Printf("Ключей данных перешифровано: %d, открытых строк зашифровано: %d",
+		report.Rewrapped, report.Encrypted)
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// ErrInvalidReplay — запрос на повторную обработку задан некорректно
+var ErrInvalidReplay = errors.New("некорректный запрос на повторную обработку")
+
+// ReplayRequest задает, с какого места канала повторно обработать сообщения.
+// Должно быть задано ровно одно из FromBeginning, FromSequence и FromTime.
+type ReplayRequest struct {
+	FromBeginning bool      `json:"from_beginning"`
+	FromSequence  uint64    `json:"from_sequence"`
+	FromTime      time.Time `json:"from_time"`
+
+	// ToSequence, если задан, останавливает проигрывание на этом сообщении включительно
+	ToSequence uint64 `json:"to_sequence"`
+	// DryRun только разбирает и проверяет сообщения, ничего не сохраняя
+	DryRun bool `json:"dry_run"`
+	// IdleSeconds — сколько секунд ждать новых сообщений, прежде чем считать
+	// канал прочитанным до конца
+	IdleSeconds int `json:"idle_seconds"`
+}
+
+// ReplayReport — итог повторного проигрывания канала
+type ReplayReport struct {
+	Channel       string `json:"channel"`
+	DryRun        bool   `json:"dry_run"`
+	Applied       int    `json:"applied"`
+	Skipped       int    `json:"skipped"`
+	Rejected      int    `json:"rejected"`
+	Failed        int    `json:"failed"`
+	FirstSequence uint64 `json:"first_sequence"`
+	LastSequence  uint64 `json:"last_sequence"`
+	Duration      string `json:"duration"`
+}
+
+// startOption преобразует запрос в опцию начала подписки
+func (r ReplayRequest) startOption() (stan.SubscriptionOption, error) {
+	set := 0
+	var opt stan.SubscriptionOption
+	if r.FromBeginning {
+		set++
+		opt = stan.DeliverAllAvailable()
+	}
+	if r.FromSequence > 0 {
+		set++
+		opt = stan.StartAtSequence(r.FromSequence)
+	}
+	if !r.FromTime.IsZero() {
+		set++
+		opt = stan.StartAtTime(r.FromTime)
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("%w: нужно указать ровно одно из from_beginning, from_sequence, from_time", ErrInvalidReplay)
+	}
+	return opt, nil
+}
+
+// Replay создает временную подписку на канал с указанного места и прогоняет
+// сообщения через обычный конвейер обработки. Проигрывание заканчивается,
+// когда достигнут ToSequence, новых сообщений нет IdleSeconds секунд или отменен ctx.
+func (nc *NATSClient) Replay(ctx context.Context, req ReplayRequest) (*ReplayReport, error) {
+	start, err := req.startOption()
+	if err != nil {
+		return nil, err
+	}
+	idle := time.Duration(req.IdleSeconds) * time.Second
+	if idle <= 0 {
+		idle = 3 * time.Second
+	}
+
+	report := &ReplayReport{Channel: nc.replayChannel, DryRun: req.DryRun}
+	var mu sync.Mutex
+	activity := make(chan struct{}, 1)
+	done := make(chan struct{})
+	var doneOnce sync.Once
+
+	handler := func(msg *stan.Msg) {
+		defer msg.Ack()
+		if req.ToSequence > 0 && msg.Sequence > req.ToSequence {
+			doneOnce.Do(func() { close(done) })
+			return
+		}
+
+		source := fmt.Sprintf("replay:%s#%d", msg.Subject, msg.Sequence)
+		outcome, order, err := nc.processor.Process(msg.Data, source, req.DryRun)
+
+		mu.Lock()
+		if report.FirstSequence == 0 {
+			report.FirstSequence = msg.Sequence
+		}
+		report.LastSequence = msg.Sequence
+		switch outcome {
+		case OutcomeApplied:
+			report.Applied++
+		case OutcomeSkipped:
+			report.Skipped++
+		case OutcomeRejected:
+			report.Rejected++
+		default:
+			report.Failed++
+		}
+		mu.Unlock()
+
+		if err != nil {
+			log.Printf("Replay: сообщение %d: %v", msg.Sequence, err)
+		} else if outcome == OutcomeApplied && !req.DryRun {
+			log.Printf("Replay: заказ %s восстановлен из сообщения %d", order.OrderUID, msg.Sequence)
+		}
+
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+		if req.ToSequence > 0 && msg.Sequence >= req.ToSequence {
+			doneOnce.Do(func() { close(done) })
+		}
+	}
+
+	nc.mu.RLock()
+	conn := nc.conn
+	nc.mu.RUnlock()
+
+	started := time.Now()
+	sub, err := conn.Subscribe(nc.replayChannel, handler,
+		start,
+		stan.SetManualAckMode(),
+		stan.MaxInflight(1024),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временной подписки: %w", err)
+	}
+	log.Printf("Replay канала '%s' запущен (dry-run: %v)", nc.replayChannel, req.DryRun)
+
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-done:
+			break wait
+		case <-activity:
+			timer.Reset(idle)
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	// Временная подписка не durable — удаляем ее с сервера
+	if err := sub.Unsubscribe(); err != nil {
+		log.Printf("Replay: ошибка при отписке: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	report.Duration = time.Since(started).Round(time.Millisecond).String()
+	log.Printf("Replay завершен: применено %d, пропущено %d, отклонено %d, ошибок %d",
+		report.Applied, report.Skipped, report.Rejected, report.Failed)
+	return report, ctx.Err()
+}
+
+// runReplay выполняет команду replay:
+// orders-service replay (-from-beginning | -from-sequence N | -from-time T) [-to-sequence N] [-dry-run]
+func runReplay(cfg Config, db *DB, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var req ReplayRequest
+	fs.BoolVar(&req.FromBeginning, "from-beginning", false, "с начала канала")
+	fs.Uint64Var(&req.FromSequence, "from-sequence", 0, "с номера сообщения")
+	fromTime := fs.String("from-time", "", "с момента времени (RFC 3339)")
+	fs.Uint64Var(&req.ToSequence, "to-sequence", 0, "по номер сообщения включительно")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "только проверить сообщения, ничего не сохраняя")
+	fs.IntVar(&req.IdleSeconds, "idle", 3, "сколько секунд ждать новых сообщений")
+	fs.Parse(args)
+
+	if *fromTime != "" {
+		t, err := time.Parse(time.RFC3339, *fromTime)
+		if err != nil {
+			return fmt.Errorf("%w: from-time: %v", ErrInvalidReplay, err)
+		}
+		req.FromTime = t
+	}
+	if _, err := req.startOption(); err != nil {
+		return err
+	}
+
+	// Отдельный ID клиента, чтобы не конфликтовать с работающим экземпляром.
+	// Кэш команды пуст, поэтому заказы сравниваются с БД: неизмененные не
+	// сохраняются повторно.
+	cfg.ClientID += "-replay"
+	processor := NewOrderProcessor(db, NewOrderCache(), cfg.StrictJSON)
+	processor.CompareWithDB()
+	nc, err := NewNATSClient(cfg, processor)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к NATS Streaming: %w", err)
+	}
+	defer nc.Close()
+	// Работающие экземпляры узнают о сохраненных заказах так же, как от других
+	// реплик: через NOTIFY (его отправляет SaveOrder) и/или анонс в NATS
+	if cfg.SyncViaNATS() {
+		nc.AnnounceTo(cfg.BroadcastChannel, cfg.InstanceID+"-replay")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	report, err := nc.Replay(ctx, req)
+	if report == nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
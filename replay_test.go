@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReplayIsIdempotent(t *testing.T) {
+	data, err := os.ReadFile("model/testdata/order.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Версия заказа в БД: с updated_at и датой в другом часовом поясе
+	stored := testOrder(t)
+	stored.UpdatedAt = time.Now()
+	stored.DateCreated = stored.DateCreated.In(time.FixedZone("MSK", 3*60*60))
+	db := map[string]*Order{stored.OrderUID: stored}
+
+	// Как у команды replay: кэш пуст, заказы сравниваются с БД
+	p := NewOrderProcessor(nil, NewOrderCache(), false)
+	p.current = func(orderUID string) (*Order, bool) {
+		order, ok := db[orderUID]
+		return order, ok
+	}
+
+	for i := range 2 {
+		outcome, _, err := p.Process(data, "replay:orders#1", false)
+		if err != nil || outcome != OutcomeSkipped {
+			t.Fatalf("проигрывание %d: %s, %v; ожидалось %s", i+1, outcome, err, OutcomeSkipped)
+		}
+	}
+
+	changed := testOrder(t)
+	changed.TrackNumber = "CHANGED"
+	data, err = json.Marshal(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome, _, err := p.Process(data, "replay:orders#2", true); err != nil || outcome != OutcomeApplied {
+		t.Errorf("измененный заказ: %s, %v; ожидалось %s", outcome, err, OutcomeApplied)
+	}
+
+	delete(db, stored.OrderUID)
+	if outcome, _, _ := p.Process(data, "replay:orders#3", true); outcome != OutcomeApplied {
+		t.Errorf("заказ, которого нет в БД: %s, ожидалось %s", outcome, OutcomeApplied)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Способы поиска заказов
+const (
+	// SearchPostgres ищет по полнотекстовым индексам delivery и items
+	SearchPostgres = "postgres"
+	// SearchCache перебирает заказы в кэше; подходит для небольших объемов и
+	// для БД с зашифрованными персональными данными
+	SearchCache = "cache"
+)
+
+const (
+	// searchMaxTerms — сколько слов запроса учитывается
+	searchMaxTerms = 8
+	// searchMaxHighlights — сколько фрагментов с подсветкой возвращается на заказ
+	searchMaxHighlights = 5
+	// Маркеры начала и конца совпадения. Фрагменты экранируются как HTML, а
+	// маркеры затем заменяются на <mark>, поэтому данные заказа не могут
+	// внедрить разметку.
+	markStart = "\x01"
+	markStop  = "\x02"
+)
+
+func init() {
+	metrics.Describe("orders_search_fallback_total", "Поисковые запросы, выполненные по кэшу из-за ошибки БД")
+}
+
+// SearchResult — найденный заказ с релевантностью и фрагментами, в которых
+// совпадения выделены тегом <mark>
+type SearchResult struct {
+	Order      *Order   `json:"order"`
+	Rank       float64  `json:"rank"`
+	Highlights []string `json:"highlights"`
+}
+
+// SearchPage — страница результатов поиска, самые релевантные первыми
+type SearchPage struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	// Backend — где выполнен поиск: postgres или cache
+	Backend string `json:"backend"`
+}
+
+// searchHit — совпадение без самого заказа
+type searchHit struct {
+	OrderUID   string
+	Rank       float64
+	Highlights []string
+}
+
+// searchTerms разбивает запрос на слова из букв и цифр в нижнем регистре.
+// Остальные символы отбрасываются, поэтому слова безопасно подставлять в
+// синтаксис to_tsquery.
+func searchTerms(q string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(q), notWordRune) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == searchMaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// tsQuery строит запрос to_tsquery: все слова, каждое как префикс
+func tsQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// highlight экранирует фрагмент как HTML и заменяет маркеры совпадений на <mark>
+func highlight(fragment string) string {
+	fragment = html.EscapeString(fragment)
+	fragment = strings.ReplaceAll(fragment, markStart, "<mark>")
+	return strings.ReplaceAll(fragment, markStop, "</mark>")
+}
+
+// deliverySearchFields — поля доставки, по которым выполняется поиск, в
+// порядке вывода в подсветке
+var deliverySearchFields = []string{"name", "city", "region"}
+
+// searchFields возвращает поля доставки, доступные для поиска и подсветки:
+// с правом на персональные данные (pii) — все, иначе — те, которые redactor не
+// маскирует (PII_MASK_FIELDS). Иначе по результатам поиска можно было бы
+// подобрать скрытое значение.
+func searchFields(redactor *Redactor, pii bool) []string {
+	var fields []string
+	for _, field := range deliverySearchFields {
+		if pii || !redactor.Masks(field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// deliverySearch возвращает для полей доставки fields выражение tsvector, по
+// которому проверяется совпадение, и текст для подсветки. Имя из
+// зашифрованной строки не участвует ни там, ни там. Пустые выражения —
+// доставка в поиске не участвует.
+func deliverySearch(fields []string) (vector, text string) {
+	if len(fields) == 0 {
+		return "", ""
+	}
+	var vectors, texts []string
+	for _, field := range fields {
+		column, weight := "d."+field, "C"
+		if field == "name" {
+			column, weight = "CASE WHEN d.pii_key_id IS NULL THEN d.name END", "A"
+		}
+		for _, config := range []string{"russian", "english"} {
+			vectors = append(vectors, fmt.Sprintf("setweight(to_tsvector('%s', coalesce(%s, '')), '%s')", config, column, weight))
+		}
+		texts = append(texts, "NULLIF("+column+", '')")
+	}
+	return "(" + strings.Join(vectors, " || ") + ")", "concat_ws(', ', " + strings.Join(texts, ", ") + ")"
+}
+
+// SearchOrders ищет заказы по полнотекстовым индексам: полям доставки fields
+// (см. searchFields), названию и бренду товаров. Все слова запроса должны
+// встретиться в доставке или в одном товаре. Возвращает страницу совпадений и
+// их общее число.
+func (db *DB) SearchOrders(ctx context.Context, terms []string, fields []string, limit, offset int) ([]searchHit, int, error) {
+	options := "StartSel=" + markStart + ", StopSel=" + markStop + ", HighlightAll=true"
+	// Индекс d.search покрывает все поля доставки и отбирает кандидатов, а
+	// совпадение проверяется уже по доступным пользователю полям
+	vector, text := deliverySearch(fields)
+	var deliveryMatches, deliveryHeadlines, deliveryCount string
+	if vector != "" {
+		match := "d.search @@ q.query AND " + vector + " @@ q.query"
+		deliveryMatches = `
+			UNION ALL
+			SELECT d.order_uid, ts_rank(` + vector + `, q.query)
+			FROM delivery d, q
+			WHERE ` + match
+		deliveryHeadlines = `
+				UNION ALL
+				SELECT ts_rank(` + vector + `, q.query),
+					ts_headline('russian', ` + text + `, q.query, $4)
+				FROM delivery d
+				WHERE d.order_uid = p.order_uid AND ` + match
+		deliveryCount = `
+				UNION ALL
+				SELECT d.order_uid FROM delivery d, q WHERE ` + match
+	}
+	// Сначала ранжируются и отбираются на страницу только order_uid, а
+	// дорогой ts_headline строится лишь для заказов страницы
+	rows, err := db.pool.Query(ctx, `
+		WITH q AS (
+			SELECT to_tsquery('russian', $1) || to_tsquery('english', $1) AS query
+		), matches AS (
+			SELECT i.order_uid, ts_rank(i.search, q.query) AS rank
+			FROM items i, q
+			WHERE i.search @@ q.query`+deliveryMatches+`
+		), page AS (
+			SELECT order_uid, sum(rank)::float8 AS rank, count(*) OVER () AS total
+			FROM matches
+			GROUP BY order_uid
+			ORDER BY rank DESC, order_uid
+			LIMIT $2 OFFSET $3
+		)
+		SELECT p.order_uid, p.rank, ARRAY(
+			SELECT headline FROM (
+				SELECT ts_rank(i.search, q.query) AS rank,
+					ts_headline('russian', concat_ws(' ', NULLIF(i.brand, ''), i.name), q.query, $4) AS headline
+				FROM items i
+				WHERE i.order_uid = p.order_uid AND i.search @@ q.query`+deliveryHeadlines+`
+				ORDER BY rank DESC
+				LIMIT $5) h
+			ORDER BY rank DESC), p.total
+		FROM page p, q
+		ORDER BY p.rank DESC, p.order_uid`,
+		tsQuery(terms), limit, offset, options, searchMaxHighlights)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка полнотекстового поиска: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	total := 0
+	for rows.Next() {
+		var hit searchHit
+		var headlines []string
+		if err := rows.Scan(&hit.OrderUID, &hit.Rank, &headlines, &total); err != nil {
+			return nil, 0, fmt.Errorf("ошибка чтения результата поиска: %w", err)
+		}
+		for _, headline := range headlines {
+			if len(hit.Highlights) == searchMaxHighlights {
+				break
+			}
+			if strings.Contains(headline, markStart) {
+				hit.Highlights = append(hit.Highlights, highlight(headline))
+			}
+		}
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ошибка полнотекстового поиска: %w", err)
+	}
+	if len(hits) == 0 && offset > 0 {
+		// За пределами последней страницы оконная функция не вернет общее число
+		err := db.pool.QueryRow(ctx, `
+			WITH q AS (SELECT to_tsquery('russian', $1) || to_tsquery('english', $1) AS query)
+			SELECT count(DISTINCT order_uid) FROM (
+				SELECT i.order_uid FROM items i, q WHERE i.search @@ q.query`+deliveryCount+`) hits`,
+			tsQuery(terms)).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("ошибка подсчета результатов поиска: %w", err)
+		}
+	}
+	return hits, total, nil
+}
+
+// searchRow — строка, в которой ищет searchCache (доставка или товар), и ее вес
+type searchRow struct {
+	text   string
+	weight float64
+}
+
+// searchCache ищет заказы перебором по тем же правилам, что и SearchOrders:
+// каждое слово запроса — начало слова в доставке (только в полях fields) или
+// в одном товаре, и все слова должны встретиться в одной строке. Возвращает
+// все совпадения, самые релевантные первыми.
+func searchCache(orders []*Order, terms []string, fields []string) []searchHit {
+	var hits []searchHit
+	for _, order := range orders {
+		var rows []searchRow
+		if text, weight := deliveryRow(&order.Delivery, fields); text != "" {
+			rows = append(rows, searchRow{text, weight})
+		}
+		for _, item := range order.Items {
+			rows = append(rows, searchRow{joinNonEmpty(" ", item.Brand, item.Name), 0.6})
+		}
+
+		hit := searchHit{OrderUID: order.OrderUID}
+		for _, row := range rows {
+			if !matchesAll(row.text, terms) {
+				continue
+			}
+			hit.Rank += row.weight
+			if len(hit.Highlights) < searchMaxHighlights {
+				hit.Highlights = append(hit.Highlights, highlight(markTerms(row.text, terms)))
+			}
+		}
+		if hit.Rank > 0 {
+			hits = append(hits, hit)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].OrderUID < hits[j].OrderUID
+	})
+	return hits
+}
+
+// deliveryRow возвращает текст полей доставки fields через запятую и вес
+// строки: имя покупателя весит больше города и региона
+func deliveryRow(d *Delivery, fields []string) (string, float64) {
+	values := map[string]string{"name": d.Name, "city": d.City, "region": d.Region}
+	var parts []string
+	weight := 0.4
+	for _, field := range fields {
+		parts = append(parts, values[field])
+		if field == "name" && d.Name != "" {
+			weight = 1
+		}
+	}
+	return joinNonEmpty(", ", parts...), weight
+}
+
+// matchesAll сообщает, начинается ли с каждого слова запроса какое-нибудь
+// слово текста
+func matchesAll(text string, terms []string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), notWordRune)
+	for _, term := range terms {
+		if !slices.ContainsFunc(words, func(w string) bool { return strings.HasPrefix(w, term) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// notWordRune сообщает, разделяет ли символ слова
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// joinNonEmpty соединяет непустые строки через sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
+
+// markTerms окружает маркерами слова text, которые начинаются со слов запроса,
+// без учета регистра
+func markTerms(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Смена регистра изменила длину строки: выделяется вся строка
+		return markStart + text + markStop
+	}
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if (i == 0 || notWordRune(lower[i-1])) && string(lower[i:i+len(t)]) == term {
+				for j := i; j < i+len(t); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(markStart)
+		}
+		b.WriteRune(r)
+		if marked[i] && (i == len(runes)-1 || !marked[i+1]) {
+			b.WriteString(markStop)
+		}
+	}
+	return b.String()
+}
+
+// Searcher выполняет поиск заказов в БД или в кэше. Если БД недоступна,
+// поиск выполняется по кэшу.
+type Searcher struct {
+	db      *DB
+	cache   *OrderCache
+	backend string
+}
+
+// NewSearcher создает поиск заказов; backend — SearchPostgres или SearchCache
+func NewSearcher(db *DB, cache *OrderCache, backend string) (*Searcher, error) {
+	if backend != SearchPostgres && backend != SearchCache {
+		return nil, fmt.Errorf("неизвестный способ поиска %q: ожидается %s или %s", backend, SearchPostgres, SearchCache)
+	}
+	return &Searcher{db: db, cache: cache, backend: backend}, nil
+}
+
+// Search возвращает страницу заказов, подходящих под запрос q. Из полей
+// доставки ищутся и подсвечиваются только fields (см. searchFields).
+func (s *Searcher) Search(ctx context.Context, q string, fields []string, limit, offset int) *SearchPage {
+	page := &SearchPage{Query: q, Results: []SearchResult{}, Limit: limit, Offset: offset, Backend: s.backend}
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return page
+	}
+
+	var hits []searchHit
+	if s.backend == SearchPostgres {
+		var err error
+		hits, page.Total, err = s.db.SearchOrders(ctx, terms, fields, limit, offset)
+		if err != nil {
+			log.Printf("Поиск по БД не выполнен, используется кэш: %v", err)
+			metrics.Inc("orders_search_fallback_total")
+			page.Backend = SearchCache
+		}
+	}
+	if page.Backend == SearchCache {
+		hits = searchCache(s.cache.GetAll(), terms, fields)
+		page.Total = len(hits)
+		hits = hits[min(offset, len(hits)):min(offset+limit, len(hits))]
+	}
+
+	for _, hit := range hits {
+		order, ok := s.cache.Get(hit.OrderUID)
+		if !ok {
+			// Заказ удален между поиском и чтением кэша
+			continue
+		}
+		if hit.Highlights == nil {
+			hit.Highlights = []string{}
+		}
+		page.Results = append(page.Results, SearchResult{Order: order, Rank: hit.Rank, Highlights: hit.Highlights})
+	}
+	return page
+}
+
+// handleSearch ищет заказы по имени покупателя, городу и региону доставки,
+// названию и бренду товаров. Пользователи без права на персональные данные
+// ищут только по полям доставки, которые им не маскируются, и получают заказы
+// замаскированными, как в других методах API.
+func (s *Server) handleSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.searcher == nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "поиск не настроен")
+			return
+		}
+		q := r.URL.Query()
+		query := strings.TrimSpace(q.Get("q"))
+		if query == "" || len(query) > 200 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "q: от 1 до 200 символов")
+			return
+		}
+		limit, err := queryInt(q.Get("limit"), 20)
+		if err != nil || limit < 1 || limit > 100 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "limit: 1..100")
+			return
+		}
+		offset, err := queryInt(q.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "offset: >= 0")
+			return
+		}
+
+		fields := searchFields(s.redactor, principalFrom(r.Context()).Can(PermPII))
+		page := s.searcher.Search(r.Context(), query, fields, limit, offset)
+		for i := range page.Results {
+			page.Results[i].Order = s.present(r, page.Results[i].Order)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}
+}
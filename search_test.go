@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSearchHidesNamesWithoutPII(t *testing.T) {
+	cache := NewOrderCache()
+	order := testOrder(t)
+	order.Delivery.Name = "Test Testov"
+	order.Delivery.City = "Kiryat Mozkin"
+	cache.Set(order.OrderUID, order)
+
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "viewer-key:viewer,support-key:support"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	searcher, err := NewSearcher(nil, cache, SearchCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(cache, nil, nil)
+	s.SetAuthenticator(auth)
+	s.SetSearcher(searcher)
+
+	search := func(key, q string) SearchPage {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/search?q="+url.QueryEscape(q), nil)
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: статус %d: %s", q, rec.Code, rec.Body)
+		}
+		var page SearchPage
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+
+	if page := search("support-key", "testov"); page.Total != 1 {
+		t.Errorf("support: по имени найдено %d заказов, ожидался 1", page.Total)
+	}
+	if page := search("viewer-key", "testov"); page.Total != 0 {
+		t.Errorf("viewer: поиск по имени нашел %d заказов", page.Total)
+	}
+
+	page := search("viewer-key", "test mozkin")
+	if page.Total != 0 {
+		t.Errorf("viewer: имя учтено в поиске вместе с городом, найдено %d", page.Total)
+	}
+	page = search("viewer-key", "mozkin")
+	if page.Total != 1 {
+		t.Fatalf("viewer: по городу найдено %d заказов, ожидался 1", page.Total)
+	}
+	result := page.Results[0]
+	if result.Order.Delivery.Name == order.Delivery.Name {
+		t.Error("viewer: имя покупателя в результате не замаскировано")
+	}
+	for _, h := range result.Highlights {
+		if strings.Contains(h, "Testov") {
+			t.Errorf("viewer: имя покупателя в подсветке: %s", h)
+		}
+	}
+}
+
+// searchFixture — заказы, на которых оба способа поиска проверяются одинаково.
+// Слова подобраны так, чтобы словоформы PostgreSQL не влияли на результат.
+func searchFixture(t *testing.T) []*Order {
+	a := testOrder(t)
+	a.OrderUID = "search-test-a"
+	a.Delivery.Name = "Ivan Petrov"
+	a.Delivery.City = "Kazan"
+	a.Delivery.Region = "Tatarstan"
+	a.Items = a.Items[:1]
+	a.Items[0].Brand = "Nike"
+	a.Items[0].Name = "Air Zoom"
+
+	b := testOrder(t)
+	b.OrderUID = "search-test-b"
+	b.Delivery.Name = "Anna Kazanova"
+	b.Delivery.City = "Moscow"
+	b.Delivery.Region = "Moscow"
+	b.Items = b.Items[:1]
+	b.Items[0].Brand = "Puma"
+	b.Items[0].Name = "Kazan cap"
+	return []*Order{a, b}
+}
+
+var (
+	allFields    = []string{"name", "city", "region"}
+	viewerFields = []string{"city", "region"}
+	regionOnly   = []string{"region"}
+)
+
+// searchCases — запросы и ожидаемые заказы для обоих способов поиска: все
+// слова должны быть началами слов одной строки доставки или одного товара
+var searchCases = []struct {
+	q      string
+	fields []string
+	want   []string
+}{
+	{"ivan", allFields, []string{"search-test-a"}},
+	{"ivan", viewerFields, nil},
+	{"ivan kazan", allFields, []string{"search-test-a"}},
+	{"ivan kazan", viewerFields, nil},
+	{"kazan", allFields, []string{"search-test-a", "search-test-b"}},
+	{"kazan", viewerFields, []string{"search-test-a", "search-test-b"}},
+	{"kazan", regionOnly, []string{"search-test-b"}},
+	{"tatar", viewerFields, []string{"search-test-a"}},
+	{"tatar", []string{"name", "city"}, nil},
+	{"nike kazan", allFields, nil},
+	{"puma cap", viewerFields, []string{"search-test-b"}},
+	{"van", allFields, nil},
+	{"anna", nil, nil},
+}
+
+// checkSearchCases прогоняет searchCases через search и проверяет, что в
+// подсветке нет значений полей доставки, недоступных для поиска
+func checkSearchCases(t *testing.T, orders []*Order, search func(terms, fields []string) []searchHit) {
+	t.Helper()
+	byUID := make(map[string]*Order)
+	for _, order := range orders {
+		byUID[order.OrderUID] = order
+	}
+	unmark := strings.NewReplacer("<mark>", "", "</mark>", "")
+	for _, tc := range searchCases {
+		var got []string
+		for _, hit := range search(searchTerms(tc.q), tc.fields) {
+			order, ok := byUID[hit.OrderUID]
+			if !ok {
+				// Заказ не из набора (общая тестовая БД)
+				continue
+			}
+			got = append(got, hit.OrderUID)
+			for _, h := range hit.Highlights {
+				parts := strings.Split(unmark.Replace(h), ", ")
+				for field, value := range map[string]string{"name": order.Delivery.Name, "city": order.Delivery.City, "region": order.Delivery.Region} {
+					if !slices.Contains(tc.fields, field) && slices.Contains(parts, value) {
+						t.Errorf("%q %v: в подсветке скрытое поле %s: %s", tc.q, tc.fields, field, h)
+					}
+				}
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q %v: найдены %v, ожидались %v", tc.q, tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestSearchCacheCases(t *testing.T) {
+	orders := searchFixture(t)
+	checkSearchCases(t, orders, func(terms, fields []string) []searchHit {
+		return searchCache(orders, terms, fields)
+	})
+}
+
+// TestSearchPostgresCases проверяет SearchOrders на тех же случаях, что и
+// поиск по кэшу. Нужна БД со схемой сервиса в TEST_DATABASE_URL.
+func TestSearchPostgresCases(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	db, err := NewDB(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	orders := searchFixture(t)
+	var uids []string
+	for _, order := range orders {
+		uids = append(uids, order.OrderUID)
+	}
+	cleanup := func() {
+		tx, err := db.pool.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback(ctx)
+		if err := deleteOrders(ctx, tx, uids); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup()
+	defer cleanup()
+	for _, order := range orders {
+		if err := db.SaveOrder(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkSearchCases(t, orders, func(terms, fields []string) []searchHit {
+		hits, _, err := db.SearchOrders(ctx, terms, fields, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hits
+	})
+}
+
+func TestSearchFieldsFollowRedactor(t *testing.T) {
+	redactor, err := NewRedactor("phone,city")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchFields(redactor, false); !slices.Equal(got, []string{"name", "region"}) {
+		t.Errorf("без права на персональные данные: %v", got)
+	}
+	if got := searchFields(redactor, true); !slices.Equal(got, deliverySearchFields) {
+		t.Errorf("с правом на персональные данные: %v", got)
+	}
+	for _, fields := range [][]string{nil, {"region"}} {
+		vector, text := deliverySearch(fields)
+		if strings.Contains(vector+text, "d.name") || strings.Contains(vector+text, "d.city") {
+			t.Errorf("%v: в выражениях поиска скрытые поля: %s, %s", fields, vector, text)
+		}
+	}
+}
@@ -1,30 +1,154 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/netip"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 )
 
 type Server struct {
-	cache  *OrderCache
-	router *mux.Router
+	cache     *OrderCache
+	processor *OrderProcessor
+	nats      *NATSClient
+	router    *mux.Router
+	checks    []healthCheck
+	auth      *Authenticator
+	redactor  *Redactor
+	eraser    *Eraser
+	limiter   *RateLimiter
+	maxBody   int64
+	proxies   []netip.Prefix
+	hub       *Hub
+	wsConns   *wsConnLimiter
+	upgrader  websocket.Upgrader
+	webhooks  *WebhookDispatcher
+	searcher  *Searcher
+	stats     *Stats
 }
 
-func NewServer(cache *OrderCache) *Server {
+// healthCheck — именованная проверка зависимости сервиса
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+func NewServer(cache *OrderCache, processor *OrderProcessor, nats *NATSClient) *Server {
 	s := &Server{
-		cache:  cache,
-		router: mux.NewRouter(),
+		cache:     cache,
+		processor: processor,
+		nats:      nats,
+		router:    mux.NewRouter(),
+		maxBody:   1 << 20,
+		wsConns:   newWSConnLimiter(defaultWSLimits),
+		upgrader:  newUpgrader(defaultWSLimits.AllowedOrigins),
 	}
+	s.redactor, _ = NewRedactor(defaultPIIFields)
 	s.routes()
+	s.checkOpenAPI()
 	return s
 }
 
 func (s *Server) routes() {
 	s.router.HandleFunc("/", s.handleIndex()).Methods("GET")
-	s.router.HandleFunc("/api/order/{id}", s.handleGetOrder()).Methods("GET")
+	s.router.HandleFunc("/api/order/{id}", s.guard(PermRead, RouteGroupRead, s.handleGetOrder())).Methods("GET")
+	s.router.HandleFunc("/api/orders", s.guard(PermRead, RouteGroupRead, s.handleListOrders())).Methods("GET")
+	s.router.HandleFunc("/api/orders/stream", s.guard(PermRead, RouteGroupRead, s.handleStream())).Methods("GET")
+	s.router.HandleFunc("/api/orders/watch", s.guard(PermRead, RouteGroupRead, s.handleWatch())).Methods("GET")
+	s.router.HandleFunc("/api/search", s.guard(PermRead, RouteGroupRead, s.handleSearch())).Methods("GET")
+	s.router.HandleFunc("/api/orders", s.guard(PermAdmin, RouteGroupWrite, s.handleIngestOrder())).Methods("POST")
+	for _, report := range []string{"summary", "revenue", "breakdown", "top"} {
+		s.router.HandleFunc("/api/stats/"+report, s.guard(PermRead, RouteGroupRead, s.handleStats(report))).Methods("GET")
+	}
+	s.router.HandleFunc("/api/session", s.guard(PermRead, RouteGroupRead, s.handleCreateSession())).Methods("POST")
+	s.router.HandleFunc("/api/session", s.handleDeleteSession()).Methods("DELETE")
+	s.router.HandleFunc("/health", s.handleHealth()).Methods("GET")
+	s.router.HandleFunc("/metrics", s.handleMetrics()).Methods("GET")
+	s.router.HandleFunc("/api/admin/replay", s.guard(PermAdmin, RouteGroupAdmin, s.handleReplay())).Methods("POST")
+	s.router.HandleFunc("/api/admin/erasure", s.guard(PermAdmin, RouteGroupAdmin, s.handleErasure())).Methods("POST")
+	s.router.HandleFunc("/api/admin/webhooks", s.guard(PermAdmin, RouteGroupAdmin, s.handleCreateWebhook())).Methods("POST")
+	s.router.HandleFunc("/api/admin/webhooks", s.guard(PermAdmin, RouteGroupAdmin, s.handleListWebhooks())).Methods("GET")
+	s.router.HandleFunc("/api/admin/webhooks/{id}", s.guard(PermAdmin, RouteGroupAdmin, s.handleDeleteWebhook())).Methods("DELETE")
+	s.router.HandleFunc("/api/admin/webhooks/{id}/deliveries", s.guard(PermAdmin, RouteGroupAdmin, s.handleWebhookDeliveries())).Methods("GET")
+	s.router.HandleFunc("/api/admin/webhooks/{id}/deliveries/{delivery}/retry", s.guard(PermAdmin, RouteGroupAdmin, s.handleRetryWebhookDelivery())).Methods("POST")
+	s.router.HandleFunc("/openapi.json", s.handleOpenAPI()).Methods("GET")
+	s.router.HandleFunc("/docs", s.handleDocs()).Methods("GET")
+	s.router.PathPrefix(docsAssetsPath).Handler(s.handleDocsAssets()).Methods("GET")
+
+	s.router.NotFoundHandler = withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, "")
+	}))
+	s.router.MethodNotAllowedHandler = withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" "+r.URL.Path)
+	}))
+	s.router.Use(withRequestID, withCompression)
+}
+
+// AddHealthCheck регистрирует проверку, результат которой попадет в /health
+func (s *Server) AddHealthCheck(name string, check func() error) {
+	s.checks = append(s.checks, healthCheck{name: name, check: check})
+}
+
+// SetAuthenticator включает аутентификацию API. Без нее (nil) все запросы
+// выполняются с ролью viewer.
+func (s *Server) SetAuthenticator(auth *Authenticator) {
+	s.auth = auth
+}
+
+// SetRedactor задает, какие персональные данные маскируются для
+// пользователей без права на их просмотр
+func (s *Server) SetRedactor(redactor *Redactor) {
+	s.redactor = redactor
+}
+
+// SetLimits задает ограничение частоты запросов (nil — без ограничения) и
+// максимальный размер тела запросов на запись
+func (s *Server) SetLimits(limiter *RateLimiter, maxBody int64) {
+	s.limiter = limiter
+	s.maxBody = maxBody
+}
+
+// SetTrustedProxies задает доверенные прокси: для запросов от них клиент
+// определяется по X-Forwarded-For (см. clientIP)
+func (s *Server) SetTrustedProxies(proxies []netip.Prefix) {
+	s.proxies = proxies
+}
+
+// SetHub включает поток событий /api/orders/stream и отслеживание заказов
+// через /api/orders/watch
+func (s *Server) SetHub(hub *Hub) {
+	s.hub = hub
+}
+
+// SetWebSocketLimits задает ограничения подключений к /api/orders/watch
+func (s *Server) SetWebSocketLimits(limits WSLimits) {
+	s.wsConns = newWSConnLimiter(limits)
+	s.upgrader = newUpgrader(limits.AllowedOrigins)
+}
+
+// SetWebhooks включает управление вебхуками через API
+func (s *Server) SetWebhooks(webhooks *WebhookDispatcher) {
+	s.webhooks = webhooks
+}
+
+// SetSearcher включает поиск заказов /api/search
+func (s *Server) SetSearcher(searcher *Searcher) {
+	s.searcher = searcher
+}
+
+// SetStats включает отчеты /api/stats/*
+func (s *Server) SetStats(stats *Stats) {
+	s.stats = stats
+}
+
+// SetEraser включает удаление данных покупателей через API
+func (s *Server) SetEraser(eraser *Eraser) {
+	s.eraser = eraser
 }
 
 func (s *Server) handleIndex() http.HandlerFunc {
@@ -171,6 +295,18 @@ func (s *Server) handleIndex() http.HandlerFunc {
         .items-table tr:hover {
             background: #B9AB99;
         }
+        .live {
+            margin-bottom: 20px;
+        }
+        .live-item {
+            padding: 6px 0;
+            border-bottom: 1px solid #948C7A;
+            color: #302620;
+            cursor: pointer;
+        }
+        .live-item:hover {
+            color: #6D2A22;
+        }
     </style>
 </head>
 <body>
@@ -183,6 +319,11 @@ func (s *Server) handleIndex() http.HandlerFunc {
             <button onclick="searchOrder()">Найти</button>
         </div>
         
+        <div class="live">
+            <p class="subtitle">Новые заказы</p>
+            <div id="live"></div>
+        </div>
+
         <div id="result"></div>
     </div>
 
@@ -194,10 +335,25 @@ func (s *Server) handleIndex() http.HandlerFunc {
                 return;
             }
 
-            fetch('/api/order/' + encodeURIComponent(orderId))
+            const headers = {};
+            if (localStorage.getItem('apiKey')) {
+                headers['X-API-Key'] = localStorage.getItem('apiKey');
+            }
+
+            fetch('/api/order/' + encodeURIComponent(orderId), { headers: headers })
                 .then(response => {
+                    if (response.status === 401) {
+                        const key = prompt('Введите API-ключ');
+                        if (key) {
+                            localStorage.setItem('apiKey', key);
+                            openSession().finally(watchOrders);
+                            searchOrder();
+                        }
+                    }
                     if (!response.ok) {
-                        throw new Error('Заказ не найден');
+                        return response.json()
+                            .catch(() => ({ title: 'Ошибка ' + response.status }))
+                            .then(problem => { throw new Error(problem.title); });
                     }
                     return response.json();
                 })
@@ -265,6 +421,43 @@ func (s *Server) handleIndex() http.HandlerFunc {
             document.getElementById('result').innerHTML = html;
         }
 
+        // Лента новых заказов: EventSource сам переподключается и передает Last-Event-ID.
+        // Заголовки EventSource задать нельзя, поэтому ключ передается через
+        // HttpOnly-cookie сессии, а не в адресе запроса.
+        let source = null;
+        function openSession() {
+            const key = localStorage.getItem('apiKey');
+            if (!key) {
+                return Promise.resolve();
+            }
+            return fetch('/api/session', { method: 'POST', headers: { 'X-API-Key': key } });
+        }
+        function watchOrders() {
+            if (source) {
+                source.close();
+            }
+            source = new EventSource('/api/orders/stream');
+            const show = event => {
+                const data = JSON.parse(event.data);
+                const item = document.createElement('div');
+                item.className = 'live-item';
+                item.textContent = new Date(data.at).toLocaleTimeString() + ' — ' +
+                    (data.type === 'order.created' ? 'новый' : 'изменен') + ': ' + data.order.order_uid;
+                item.onclick = () => {
+                    document.getElementById('orderId').value = data.order.order_uid;
+                    searchOrder();
+                };
+                const live = document.getElementById('live');
+                live.prepend(item);
+                while (live.children.length > 10) {
+                    live.lastChild.remove();
+                }
+            };
+            source.addEventListener('order.created', show);
+            source.addEventListener('order.updated', show);
+        }
+        openSession().finally(watchOrders);
+
         // Поиск по Enter
         document.getElementById('orderId').addEventListener('keypress', function(e) {
             if (e.key === 'Enter') {
@@ -281,19 +474,115 @@ func (s *Server) handleIndex() http.HandlerFunc {
 	}
 }
 
+// handleGetOrder отдает заказ из кэша с заранее сериализованным JSON.
+// ETag и Last-Modified позволяют клиентам, опрашивающим заказ, получать 304
+// вместо повторной передачи неизменившегося заказа.
 func (s *Server) handleGetOrder() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		orderID := vars["id"]
 
-		order, exists := s.cache.Get(orderID)
+		entry, exists := s.cache.Lookup(orderID)
 		if !exists {
-			http.Error(w, "Заказ не найден", http.StatusNotFound)
+			writeProblem(w, r, http.StatusNotFound, CodeOrderNotFound, "")
+			return
+		}
+
+		body, etag := entry.JSON, entry.ETag
+		if presented := s.present(r, entry.Order); presented != entry.Order {
+			body, etag = presentedJSON(presented)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		// Содержимое зависит от роли: персональные данные могут быть замаскированы
+		w.Header().Add("Vary", "Authorization, X-API-Key, Cookie")
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", entry.Modified, bytes.NewReader(body))
+	}
+}
+
+func (s *Server) handleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		code := http.StatusOK
+		checks := make(map[string]string, len(s.checks))
+		for _, hc := range s.checks {
+			if err := hc.check(); err != nil {
+				checks[hc.name] = err.Error()
+				status = "unavailable"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			checks[hc.name] = "ok"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": status,
+			"checks": checks,
+		})
+	}
+}
+
+func (s *Server) handleMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WriteTo(w)
+	}
+}
+
+func (s *Server) handleReplay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ReplayRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		report, err := s.nats.Replay(r.Context(), req)
+		switch {
+		case report != nil:
+		case errors.Is(err, ErrInvalidReplay):
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		default:
+			log.Printf("Ошибка повторной обработки канала: %v", err)
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// handleErasure удаляет или обезличивает данные покупателя по customer_id
+func (s *Server) handleErasure() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.eraser == nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "удаление данных не настроено")
+			return
+		}
+
+		var req ErasureRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		report, err := s.eraser.Erase(r.Context(), req, principalFrom(r.Context()).Subject)
+		switch {
+		case errors.Is(err, ErrInvalidErasure):
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		case err != nil:
+			log.Printf("Ошибка удаления данных покупателя: %v", err)
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(order)
+		json.NewEncoder(w).Encode(report)
 	}
 }
 
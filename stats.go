@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// statsDefaultPeriod — диапазон по умолчанию, если from не задан
+	statsDefaultPeriod = 30 * 24 * time.Hour
+	// statsMaxPeriod — наибольший допустимый диапазон
+	statsMaxPeriod = 2 * 366 * 24 * time.Hour
+)
+
+var ErrInvalidStatsRange = errors.New("некорректный диапазон статистики")
+
+// StatsRange — диапазон дат создания заказов [From, To)
+type StatsRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// key — нормализованный диапазон для ключа кэша. Границы, отсчитанные от
+	// текущего момента, записываются как now и длина периода, иначе ключ
+	// менялся бы с каждым запросом.
+	key string
+}
+
+// CurrencyTotal — выручка в одной валюте. Заказы без оплаты попадают в
+// валюту "".
+type CurrencyTotal struct {
+	Currency string `json:"currency"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+	// AvgOrder — средняя сумма оплаты заказа
+	AvgOrder float64 `json:"avg_order"`
+	// AvgGoods — средняя стоимость товаров в заказе без доставки
+	AvgGoods float64 `json:"avg_goods"`
+}
+
+// StatsSummary — общие показатели за диапазон
+type StatsSummary struct {
+	StatsRange
+	Orders  int64           `json:"orders"`
+	Revenue []CurrencyTotal `json:"revenue"`
+	// AvgItems — среднее число товаров в заказе
+	AvgItems float64 `json:"avg_items"`
+	// AvgSale — средняя скидка на товар, %
+	AvgSale     float64   `json:"avg_sale"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// DailyRevenue — выручка за день (UTC) в одной валюте
+type DailyRevenue struct {
+	Day      string `json:"day"`
+	Currency string `json:"currency"`
+	Orders   int64  `json:"orders"`
+	Revenue  int64  `json:"revenue"`
+}
+
+// StatsRevenue — выручка по дням и валютам
+type StatsRevenue struct {
+	StatsRange
+	Days        []DailyRevenue `json:"days"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// StatsCount — число заказов с одним значением поля
+type StatsCount struct {
+	Value  string `json:"value"`
+	Orders int64  `json:"orders"`
+}
+
+// StatsBreakdown — число заказов по службе доставки, локали, точке входа и региону
+type StatsBreakdown struct {
+	StatsRange
+	DeliveryService []StatsCount `json:"delivery_service"`
+	Locale          []StatsCount `json:"locale"`
+	Entry           []StatsCount `json:"entry"`
+	Region          []StatsCount `json:"region"`
+	GeneratedAt     time.Time    `json:"generated_at"`
+}
+
+// TopBrand — бренд с числом проданных товаров и выручкой по валютам
+type TopBrand struct {
+	Brand   string           `json:"brand"`
+	Items   int64            `json:"items"`
+	Orders  int64            `json:"orders"`
+	Revenue map[string]int64 `json:"revenue"`
+}
+
+// TopItem — товар (nm_id) с числом продаж и выручкой по валютам
+type TopItem struct {
+	NmID    int64            `json:"nm_id"`
+	Name    string           `json:"name"`
+	Brand   string           `json:"brand"`
+	Items   int64            `json:"items"`
+	Orders  int64            `json:"orders"`
+	Revenue map[string]int64 `json:"revenue"`
+}
+
+// StatsTop — самые продаваемые бренды и товары по числу проданных единиц
+type StatsTop struct {
+	StatsRange
+	Brands      []TopBrand `json:"brands"`
+	Items       []TopItem  `json:"items"`
+	GeneratedAt time.Time  `json:"generated_at"`
+}
+
+// ParseStatsRange разбирает параметры from, to (RFC 3339 или ГГГГ-ММ-ДД) и
+// period (например 24h, 7d). По умолчанию — последние 30 дней.
+func ParseStatsRange(q url.Values, now time.Time) (StatsRange, error) {
+	r := StatsRange{To: now.UTC()}
+	var err error
+	if v := q.Get("to"); v != "" {
+		if r.To, err = parseStatsTime(v); err != nil {
+			return r, fmt.Errorf("%w: to: %v", ErrInvalidStatsRange, err)
+		}
+	}
+	period := statsDefaultPeriod
+	if v := q.Get("period"); v != "" {
+		if period, err = parseStatsPeriod(v); err != nil {
+			return r, fmt.Errorf("%w: period: %v", ErrInvalidStatsRange, err)
+		}
+	}
+	r.From = r.To.Add(-period)
+	fromKey := "-" + period.String()
+	if v := q.Get("from"); v != "" {
+		if q.Get("period") != "" {
+			return r, fmt.Errorf("%w: from и period взаимоисключающие", ErrInvalidStatsRange)
+		}
+		if r.From, err = parseStatsTime(v); err != nil {
+			return r, fmt.Errorf("%w: from: %v", ErrInvalidStatsRange, err)
+		}
+		fromKey = r.From.Format(time.RFC3339Nano)
+	}
+	if !r.From.Before(r.To) {
+		return r, fmt.Errorf("%w: from должен быть раньше to", ErrInvalidStatsRange)
+	}
+	if r.To.Sub(r.From) > statsMaxPeriod {
+		return r, fmt.Errorf("%w: диапазон больше двух лет", ErrInvalidStatsRange)
+	}
+	toKey := "now"
+	if q.Get("to") != "" {
+		toKey = r.To.Format(time.RFC3339Nano)
+	}
+	r.key = fromKey + ".." + toKey
+	return r, nil
+}
+
+func parseStatsTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("ожидается ГГГГ-ММ-ДД или RFC 3339")
+	}
+	return t.UTC(), nil
+}
+
+// parseStatsPeriod понимает длительности Go (24h) и дни (7d)
+func parseStatsPeriod(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("ожидается число дней, например 7d")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("ожидается длительность, например 24h или 7d")
+	}
+	return d, nil
+}
+
+// StatsSummary считает число заказов, выручку по валютам, средний размер
+// корзины и среднюю скидку
+func (db *DB) StatsSummary(ctx context.Context, r StatsRange) (*StatsSummary, error) {
+	summary := &StatsSummary{StatsRange: r, Revenue: []CurrencyTotal{}, GeneratedAt: time.Now().UTC()}
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT coalesce(p.currency, ''), count(*), coalesce(sum(p.amount), 0)::bigint,
+			coalesce(avg(p.amount), 0)::float8, coalesce(avg(p.goods_total), 0)::float8
+		FROM orders o
+		LEFT JOIN payment p USING (order_uid)
+		WHERE o.date_created >= $1 AND o.date_created < $2
+		GROUP BY 1
+		ORDER BY 2 DESC, 1`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета выручки: %w", err)
+	}
+	for rows.Next() {
+		var t CurrencyTotal
+		if err := rows.Scan(&t.Currency, &t.Orders, &t.Revenue, &t.AvgOrder, &t.AvgGoods); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения выручки: %w", err)
+		}
+		summary.Revenue = append(summary.Revenue, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета выручки: %w", err)
+	}
+
+	err = db.pool.QueryRow(ctx, `
+		WITH baskets AS (
+			SELECT o.order_uid, count(i.order_uid) AS items, avg(i.sale) AS sale
+			FROM orders o
+			LEFT JOIN items i USING (order_uid)
+			WHERE o.date_created >= $1 AND o.date_created < $2
+			GROUP BY o.order_uid
+		)
+		SELECT count(*), coalesce(avg(items), 0)::float8,
+			coalesce(sum(sale * items) / nullif(sum(items), 0), 0)::float8
+		FROM baskets`, r.From, r.To).Scan(&summary.Orders, &summary.AvgItems, &summary.AvgSale)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета размера корзины: %w", err)
+	}
+	return summary, nil
+}
+
+// StatsRevenue считает выручку по дням (UTC) и валютам
+func (db *DB) StatsRevenue(ctx context.Context, r StatsRange) (*StatsRevenue, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT to_char(o.date_created::timestamptz AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+			coalesce(p.currency, ''), count(*), coalesce(sum(p.amount), 0)::bigint
+		FROM orders o
+		LEFT JOIN payment p USING (order_uid)
+		WHERE o.date_created >= $1 AND o.date_created < $2
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета выручки по дням: %w", err)
+	}
+	defer rows.Close()
+
+	revenue := &StatsRevenue{StatsRange: r, Days: []DailyRevenue{}, GeneratedAt: time.Now().UTC()}
+	for rows.Next() {
+		var d DailyRevenue
+		if err := rows.Scan(&d.Day, &d.Currency, &d.Orders, &d.Revenue); err != nil {
+			return nil, fmt.Errorf("ошибка чтения выручки по дням: %w", err)
+		}
+		revenue.Days = append(revenue.Days, d)
+	}
+	return revenue, rows.Err()
+}
+
+// statsDimensions — поля, по которым считается StatsBreakdown. Выражения
+// подставляются в SQL, поэтому список фиксирован.
+var statsDimensions = []struct {
+	expr  string
+	field func(*StatsBreakdown) *[]StatsCount
+}{
+	{"o.delivery_service", func(b *StatsBreakdown) *[]StatsCount { return &b.DeliveryService }},
+	{"o.locale", func(b *StatsBreakdown) *[]StatsCount { return &b.Locale }},
+	{"o.entry", func(b *StatsBreakdown) *[]StatsCount { return &b.Entry }},
+	{"coalesce(d.region, '')", func(b *StatsBreakdown) *[]StatsCount { return &b.Region }},
+}
+
+// StatsBreakdown считает заказы по службе доставки, локали, точке входа и региону
+func (db *DB) StatsBreakdown(ctx context.Context, r StatsRange) (*StatsBreakdown, error) {
+	breakdown := &StatsBreakdown{StatsRange: r, GeneratedAt: time.Now().UTC()}
+	for _, dim := range statsDimensions {
+		rows, err := db.pool.Query(ctx, `
+			SELECT `+dim.expr+`, count(*)
+			FROM orders o
+			LEFT JOIN delivery d USING (order_uid)
+			WHERE o.date_created >= $1 AND o.date_created < $2
+			GROUP BY 1
+			ORDER BY 2 DESC, 1`, r.From, r.To)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подсчета заказов по %s: %w", dim.expr, err)
+		}
+		counts := []StatsCount{}
+		for rows.Next() {
+			var c StatsCount
+			if err := rows.Scan(&c.Value, &c.Orders); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("ошибка чтения заказов по %s: %w", dim.expr, err)
+			}
+			counts = append(counts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("ошибка подсчета заказов по %s: %w", dim.expr, err)
+		}
+		*dim.field(breakdown) = counts
+	}
+	return breakdown, nil
+}
+
+// StatsTop находит limit самых продаваемых брендов и товаров по числу
+// проданных единиц. Выручка считается отдельно по каждой валюте.
+func (db *DB) StatsTop(ctx context.Context, r StatsRange, limit int) (*StatsTop, error) {
+	top := &StatsTop{StatsRange: r, Brands: []TopBrand{}, Items: []TopItem{}, GeneratedAt: time.Now().UTC()}
+
+	rows, err := db.pool.Query(ctx, `
+		WITH sold AS (
+			SELECT coalesce(i.brand, '') AS brand, coalesce(p.currency, '') AS currency, count(*) AS items,
+				count(DISTINCT i.order_uid) AS orders, coalesce(sum(i.total_price), 0)::bigint AS revenue
+			FROM items i
+			JOIN orders o USING (order_uid)
+			LEFT JOIN payment p USING (order_uid)
+			WHERE o.date_created >= $1 AND o.date_created < $2
+			GROUP BY 1, 2
+		), top AS (
+			SELECT brand, sum(items) AS total FROM sold GROUP BY brand ORDER BY total DESC, brand LIMIT $3
+		)
+		SELECT s.brand, s.currency, s.items, s.orders, s.revenue
+		FROM sold s JOIN top t USING (brand)
+		ORDER BY t.total DESC, s.brand, s.currency`, r.From, r.To, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета брендов: %w", err)
+	}
+	for rows.Next() {
+		var brand, currency string
+		var items, orders, revenue int64
+		if err := rows.Scan(&brand, &currency, &items, &orders, &revenue); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения брендов: %w", err)
+		}
+		if n := len(top.Brands); n == 0 || top.Brands[n-1].Brand != brand {
+			top.Brands = append(top.Brands, TopBrand{Brand: brand, Revenue: map[string]int64{}})
+		}
+		b := &top.Brands[len(top.Brands)-1]
+		b.Items += items
+		b.Orders += orders
+		b.Revenue[currency] += revenue
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета брендов: %w", err)
+	}
+
+	rows, err = db.pool.Query(ctx, `
+		WITH sold AS (
+			SELECT i.nm_id, coalesce(p.currency, '') AS currency, coalesce(max(i.name), '') AS name, coalesce(max(i.brand), '') AS brand,
+				count(*) AS items, count(DISTINCT i.order_uid) AS orders,
+				coalesce(sum(i.total_price), 0)::bigint AS revenue
+			FROM items i
+			JOIN orders o USING (order_uid)
+			LEFT JOIN payment p USING (order_uid)
+			WHERE o.date_created >= $1 AND o.date_created < $2
+			GROUP BY 1, 2
+		), top AS (
+			SELECT nm_id, sum(items) AS total FROM sold GROUP BY nm_id ORDER BY total DESC, nm_id LIMIT $3
+		)
+		SELECT s.nm_id::bigint, s.name, s.brand, s.currency, s.items, s.orders, s.revenue
+		FROM sold s JOIN top t USING (nm_id)
+		ORDER BY t.total DESC, s.nm_id, s.currency`, r.From, r.To, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета товаров: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item TopItem
+		var currency string
+		var revenue int64
+		if err := rows.Scan(&item.NmID, &item.Name, &item.Brand, &currency, &item.Items, &item.Orders, &revenue); err != nil {
+			return nil, fmt.Errorf("ошибка чтения товаров: %w", err)
+		}
+		if n := len(top.Items); n > 0 && top.Items[n-1].NmID == item.NmID {
+			last := &top.Items[n-1]
+			last.Items += item.Items
+			last.Orders += item.Orders
+			last.Revenue[currency] += revenue
+			continue
+		}
+		item.Revenue = map[string]int64{currency: revenue}
+		top.Items = append(top.Items, item)
+	}
+	return top, rows.Err()
+}
+
+// statsEntry — закэшированный ответ статистики
+type statsEntry struct {
+	value   any
+	expires time.Time
+}
+
+// Stats считает статистику заказов агрегатами SQL и кэширует ответы на
+// короткое время, чтобы частые запросы панелей не нагружали БД
+type Stats struct {
+	db      *DB
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]statsEntry
+	// inflight объединяет одновременные промахи кэша по одному ключу
+	inflight singleflight.Group
+}
+
+// NewStats создает сервис статистики; ttl — время жизни ответа в кэше
+// (0 — не кэшировать)
+func NewStats(db *DB, ttl time.Duration) *Stats {
+	return &Stats{db: db, ttl: ttl, entries: make(map[string]statsEntry)}
+}
+
+// get возвращает ответ из кэша по ключу key или вычисляет его. Пока ответ
+// вычисляется, остальные запросы с тем же ключом ждут его, а не идут в БД.
+func (s *Stats) get(key string, compute func() (any, error)) (any, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err, _ := s.inflight.Do(key, func() (any, error) {
+		value, err := compute()
+		if err == nil && s.ttl > 0 {
+			s.store(key, value)
+		}
+		return value, err
+	})
+	return value, err
+}
+
+// store кладет ответ в кэш и удаляет устаревшие
+func (s *Stats) store(key string, value any) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = statsEntry{value: value, expires: now.Add(s.ttl)}
+}
+
+// handleStats отдает отчет name. Ключ кэша — отчет, нормализованный диапазон
+// и limit для top: посторонние параметры (например, access_token) и разные
+// записи одного диапазона не дробят кэш, а «последние N дней»
+// пересчитываются не чаще раза в ttl.
+func (s *Server) handleStats(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.stats == nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "статистика не настроена")
+			return
+		}
+		q := r.URL.Query()
+		rng, err := ParseStatsRange(q, time.Now())
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+			return
+		}
+		limit, err := queryInt(q.Get("limit"), 10)
+		if err != nil || limit < 1 || limit > 100 {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidParameter, "limit: 1..100")
+			return
+		}
+
+		key := name + "|" + rng.key
+		if name == "top" {
+			key += "|" + strconv.Itoa(limit)
+		}
+		// Результат достается всем, кто ждет его в get, поэтому отмена запроса
+		// первого из них не прерывает расчет
+		ctx := context.WithoutCancel(r.Context())
+		value, err := s.stats.get(key, func() (any, error) {
+			switch name {
+			case "summary":
+				return s.stats.db.StatsSummary(ctx, rng)
+			case "revenue":
+				return s.stats.db.StatsRevenue(ctx, rng)
+			case "breakdown":
+				return s.stats.db.StatsBreakdown(ctx, rng)
+			default:
+				return s.stats.db.StatsTop(ctx, rng, limit)
+			}
+		})
+		if err != nil {
+			log.Printf("Ошибка расчета статистики %s: %v", name, err)
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(s.stats.ttl.Seconds())))
+		json.NewEncoder(w).Encode(value)
+	}
+}
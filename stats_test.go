@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatsRangeKey(t *testing.T) {
+	key := func(query string, now time.Time) string {
+		t.Helper()
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := ParseStatsRange(q, now)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return r.key
+	}
+	now := time.Now()
+
+	for _, pair := range [][2]string{
+		// Посторонние параметры и порядок не влияют на ключ
+		{"period=7d", "access_token=abc&period=7d&junk=1"},
+		// Разные записи одного диапазона
+		{"period=7d", "period=168h"},
+		{"from=2025-01-01&to=2025-02-01", "to=2025-02-01T00:00:00Z&from=2025-01-01T03:00:00%2B03:00"},
+	} {
+		if a, b := key(pair[0], now), key(pair[1], now); a != b {
+			t.Errorf("%s и %s: разные ключи %q и %q", pair[0], pair[1], a, b)
+		}
+	}
+
+	// Диапазон от текущего момента не меняет ключ со временем
+	if a, b := key("period=24h", now), key("period=24h", now.Add(time.Second)); a != b {
+		t.Errorf("ключ относительного диапазона меняется: %q и %q", a, b)
+	}
+	if a, b := key("period=7d", now), key("period=30d", now); a == b {
+		t.Errorf("разные диапазоны с одним ключом %q", a)
+	}
+}
+
+func TestStatsConcurrentMissesComputeOnce(t *testing.T) {
+	s := NewStats(nil, time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	compute := func() (any, error) {
+		calls.Add(1)
+		<-release
+		return "report", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := s.get("summary", compute); err != nil || v != "report" {
+				t.Errorf("get: %v, %v", v, err)
+			}
+		}()
+	}
+	// Даем запросам дойти до ожидания общего расчета
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if v, _ := s.get("summary", compute); v != "report" {
+		t.Errorf("ответ не закэширован: %v", v)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("расчет выполнен %d раз, ожидался 1", n)
+	}
+}
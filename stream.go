@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBufferSize — сколько последних событий хранится для возобновления
+	// потока по Last-Event-ID
+	streamBufferSize = 1024
+	// streamClientQueue — очередь событий одного клиента; клиент, который не
+	// успевает ее разбирать, отключается
+	streamClientQueue = 64
+	// streamHeartbeat — интервал комментариев, не дающих прокси закрыть соединение
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamEvent — событие потока с порядковым номером
+type streamEvent struct {
+	ID uint64
+	OrderEvent
+}
+
+// streamSubscriber — подключенный клиент потока
+type streamSubscriber struct {
+	events chan streamEvent
+	// dropped закрывается, когда клиент отключен за медленное чтение
+	dropped chan struct{}
+}
+
+// Hub раздает события о сохраненных заказах подписчикам потока и хранит
+// последние события в кольцевом буфере для возобновления после переподключения
+type Hub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	buffer      []streamEvent
+	subscribers map[*streamSubscriber]struct{}
+}
+
+// NewHub создает пустой хаб событий
+func NewHub() *Hub {
+	return &Hub{
+		// Номера событий начинаются с текущего времени в микросекундах, чтобы
+		// Last-Event-ID, полученный до перезапуска сервиса, не совпал с новыми
+		nextID:      uint64(time.Now().UnixMicro()),
+		subscribers: make(map[*streamSubscriber]struct{}),
+	}
+}
+
+func init() {
+	metrics.Describe("orders_stream_dropped_total", "Клиенты потока событий, отключенные за медленное чтение")
+}
+
+// Publish рассылает событие всем подписчикам. Не блокируется: подписчик с
+// заполненной очередью отключается и может возобновить поток по Last-Event-ID.
+func (h *Hub) Publish(event OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ev := streamEvent{ID: h.nextID, OrderEvent: event}
+	h.nextID++
+	if len(h.buffer) == streamBufferSize {
+		h.buffer = append(h.buffer[:0], h.buffer[1:]...)
+	}
+	h.buffer = append(h.buffer, ev)
+
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- ev:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.dropped)
+			metrics.Inc("orders_stream_dropped_total")
+		}
+	}
+}
+
+// Forget стирает из буфера заказ orderUID, например после удаления данных
+// покупателя: клиент, возобновляющий поток по Last-Event-ID, не должен
+// получить их снова. Номера событий сохраняются, поэтому возобновление
+// остальных клиентов не нарушается.
+func (h *Hub) Forget(orderUID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.buffer {
+		if ev := &h.buffer[i]; ev.Order != nil && ev.Order.OrderUID == orderUID {
+			ev.Order = nil
+		}
+	}
+}
+
+// Subscribe подключает клиента. lastID — последнее полученное клиентом
+// событие (0 — только новые события). Возвращает события из буфера после
+// lastID; complete = false, если часть событий после lastID уже вытеснена.
+func (h *Hub) Subscribe(lastID uint64) (sub *streamSubscriber, backlog []streamEvent, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &streamSubscriber{
+		events:  make(chan streamEvent, streamClientQueue),
+		dropped: make(chan struct{}),
+	}
+	h.subscribers[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	oldest := h.nextID
+	if len(h.buffer) > 0 {
+		oldest = h.buffer[0].ID
+	}
+	if lastID >= h.nextID || lastID+1 < oldest {
+		return sub, nil, false
+	}
+	for _, ev := range h.buffer {
+		if ev.ID > lastID {
+			backlog = append(backlog, ev)
+		}
+	}
+	return sub, backlog, true
+}
+
+// Unsubscribe отключает клиента
+func (h *Hub) Unsubscribe(sub *streamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// handleStream отдает поток Server-Sent Events о сохраненных заказах.
+// Фильтры customer_id и delivery_service необязательны. Клиент, переподключаясь,
+// передает Last-Event-ID и получает пропущенные события из буфера; если они
+// уже вытеснены, первым приходит событие reset — список нужно перечитать.
+func (s *Server) handleStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.hub == nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "поток событий не настроен")
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeProblem(w, r, http.StatusInternalServerError, CodeUnavailable, "потоковая передача не поддерживается")
+			return
+		}
+
+		lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+		customerID, deliveryService := r.URL.Query().Get("customer_id"), r.URL.Query().Get("delivery_service")
+		match := func(order *Order) bool {
+			return (customerID == "" || order.CustomerID == customerID) &&
+				(deliveryService == "" || order.DeliveryService == deliveryService)
+		}
+
+		sub, backlog, complete := s.hub.Subscribe(lastID)
+		defer s.hub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if !complete {
+			fmt.Fprintf(w, "event: reset\ndata: {}\n\n")
+		}
+
+		send := func(ev streamEvent) error {
+			// Заказ события стерт из буфера (Hub.Forget)
+			if ev.Order == nil || !match(ev.Order) {
+				return nil
+			}
+			data, err := json.Marshal(map[string]any{
+				"type":  ev.Type,
+				"at":    ev.At,
+				"order": s.present(r, ev.Order),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+			return err
+		}
+		for _, ev := range backlog {
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-sub.dropped:
+				// Клиент переподключится и получит пропущенное по Last-Event-ID
+				return
+			case ev := <-sub.events:
+				if err := send(ev); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprintf(w, ": ping\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
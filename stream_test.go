@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"orders-service/model"
+)
+
+// publishOrders публикует по событию на каждый order_uid и возвращает их номера
+func publishOrders(h *Hub, uids ...string) []uint64 {
+	var ids []uint64
+	for _, uid := range uids {
+		h.mu.Lock()
+		ids = append(ids, h.nextID)
+		h.mu.Unlock()
+		h.Publish(OrderEvent{Type: model.EventOrderCreated, Order: &Order{OrderUID: uid}, At: time.Now().UTC()})
+	}
+	return ids
+}
+
+func TestHubPublishAndResume(t *testing.T) {
+	h := NewHub()
+	live, backlog, complete := h.Subscribe(0)
+	if backlog != nil || !complete {
+		t.Fatalf("новый клиент: backlog=%v, complete=%v", backlog, complete)
+	}
+
+	ids := publishOrders(h, "a", "b", "c")
+	for _, want := range []string{"a", "b", "c"} {
+		if ev := <-live.events; ev.Order.OrderUID != want {
+			t.Errorf("получен заказ %s, ожидался %s", ev.Order.OrderUID, want)
+		}
+	}
+
+	// Клиент получил первое событие и переподключился
+	_, backlog, complete = h.Subscribe(ids[0])
+	if !complete || len(backlog) != 2 || backlog[0].ID != ids[1] || backlog[1].Order.OrderUID != "c" {
+		t.Errorf("возобновление после %d: complete=%v, backlog=%+v", ids[0], complete, backlog)
+	}
+	// Клиент уже получил все события
+	if _, backlog, complete = h.Subscribe(ids[2]); !complete || len(backlog) != 0 {
+		t.Errorf("возобновление после последнего: complete=%v, backlog=%d", complete, len(backlog))
+	}
+}
+
+func TestHubOverflow(t *testing.T) {
+	h := NewHub()
+	uids := make([]string, streamBufferSize+10)
+	for i := range uids {
+		uids[i] = strconv.Itoa(i)
+	}
+	ids := publishOrders(h, uids...)
+
+	// Первые события вытеснены: клиент должен перечитать список
+	if _, backlog, complete := h.Subscribe(ids[0]); complete || backlog != nil {
+		t.Errorf("вытесненные события: complete=%v, backlog=%d", complete, len(backlog))
+	}
+	// Номер из будущего (например, до перезапуска с переведенными часами)
+	if _, _, complete := h.Subscribe(ids[len(ids)-1] + 100); complete {
+		t.Error("номер из будущего принят")
+	}
+	_, backlog, complete := h.Subscribe(ids[len(ids)-11])
+	if !complete || len(backlog) != 10 {
+		t.Errorf("последние 10 событий: complete=%v, backlog=%d", complete, len(backlog))
+	}
+}
+
+func TestHubForget(t *testing.T) {
+	h := NewHub()
+	ids := publishOrders(h, "erased", "kept", "erased")
+	h.Forget("erased")
+
+	_, backlog, complete := h.Subscribe(ids[0] - 1)
+	if !complete || len(backlog) != 3 {
+		t.Fatalf("номера событий должны сохраниться: complete=%v, backlog=%d", complete, len(backlog))
+	}
+	for _, ev := range backlog {
+		if ev.Order != nil && ev.Order.OrderUID == "erased" {
+			t.Errorf("событие %d хранит стертый заказ", ev.ID)
+		}
+	}
+	if backlog[1].Order == nil || backlog[1].Order.OrderUID != "kept" {
+		t.Errorf("стерт чужой заказ: %+v", backlog[1])
+	}
+}
+
+// readStream возобновляет поток после lastEventID и читает события до untilID
+func readStream(t *testing.T, url, key string, lastEventID uint64, untilID uint64) []map[string]any {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/orders/stream", nil)
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(lastEventID, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("статус %d", resp.StatusCode)
+	}
+
+	var events []map[string]any
+	var id uint64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "id: "); ok {
+			id, _ = strconv.ParseUint(v, 10, 64)
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok && id != 0 {
+			var ev map[string]any
+			if err := json.Unmarshal([]byte(v), &ev); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, ev)
+			if id == untilID {
+				return events
+			}
+		}
+	}
+	t.Fatalf("поток закончился до события %d: %v", untilID, scanner.Err())
+	return nil
+}
+
+func TestStreamResumeMasksAndSkipsForgotten(t *testing.T) {
+	auth, err := NewAuthenticator(AuthConfig{APIKeys: "viewer-key:viewer,admin-key:admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub()
+	s := NewServer(NewOrderCache(), nil, nil)
+	s.SetAuthenticator(auth)
+	s.SetHub(hub)
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	order := testOrder(t)
+	erased := testOrder(t)
+	erased.OrderUID = "erased-order"
+	var ids []uint64
+	for _, o := range []*Order{erased, order} {
+		hub.mu.Lock()
+		ids = append(ids, hub.nextID)
+		hub.mu.Unlock()
+		hub.Publish(OrderEvent{Type: model.EventOrderCreated, Order: o, At: time.Now().UTC()})
+	}
+	hub.Forget(erased.OrderUID)
+
+	orderOf := func(ev map[string]any) map[string]any { return ev["order"].(map[string]any) }
+	viewer := readStream(t, ts.URL, "viewer-key", ids[0]-1, ids[1])
+	if len(viewer) != 1 || orderOf(viewer[0])["order_uid"] != order.OrderUID {
+		t.Fatalf("ожидалось только событие заказа %s, получено %v", order.OrderUID, viewer)
+	}
+	delivery := orderOf(viewer[0])["delivery"].(map[string]any)
+	if delivery["name"] == order.Delivery.Name || delivery["phone"] == order.Delivery.Phone {
+		t.Errorf("viewer получил персональные данные: %v", delivery)
+	}
+
+	admin := readStream(t, ts.URL, "admin-key", ids[0]-1, ids[1])
+	if delivery := orderOf(admin[0])["delivery"].(map[string]any); delivery["name"] != order.Delivery.Name {
+		t.Errorf("admin получил замаскированное имя %v", delivery["name"])
+	}
+}
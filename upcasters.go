@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+func init() {
+	RegisterUpcaster(1, upcastV1ToV2)
+}
+
+// upcastV1ToV2 добавляет payment.transaction, появившийся во второй версии схемы.
+// Производители первой версии его не отправляли; по спецификации он равен order_uid.
+func upcastV1ToV2(payload []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+
+	var payment map[string]json.RawMessage
+	if raw, ok := doc["payment"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &payment); err != nil {
+			return nil, err
+		}
+	}
+	if payment == nil {
+		payment = make(map[string]json.RawMessage)
+	}
+
+	if tx, ok := payment["transaction"]; !ok || string(tx) == `""` {
+		if uid, ok := doc["order_uid"]; ok {
+			payment["transaction"] = uid
+		}
+	}
+
+	raw, err := json.Marshal(payment)
+	if err != nil {
+		return nil, err
+	}
+	doc["payment"] = raw
+	return json.Marshal(doc)
+}
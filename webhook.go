@@ -0,0 +1,673 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"orders-service/model"
+)
+
+// Состояния доставки события на вебхук
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+const (
+	// webhookPollInterval — как часто проверяются доставки, время повтора
+	// которых наступило
+	webhookPollInterval = 2 * time.Second
+	// webhookBaseBackoff и webhookMaxBackoff — пауза перед повтором удваивается
+	// с каждой неудачной попыткой, начиная с базовой, но не больше максимальной
+	webhookBaseBackoff = 10 * time.Second
+	webhookMaxBackoff  = time.Hour
+)
+
+var (
+	ErrInvalidWebhook  = errors.New("некорректный вебхук")
+	ErrWebhookNotFound = errors.New("вебхук не найден")
+)
+
+func init() {
+	metrics.Describe("webhook_deliveries_total", "Попытки доставки событий на вебхуки по результату")
+}
+
+// WebhookConfig — настройки доставки событий на вебхуки
+type WebhookConfig struct {
+	// MaxAttempts — число попыток, после которого доставка считается неудачной
+	MaxAttempts int
+	// Timeout — время ожидания ответа получателя
+	Timeout time.Duration
+	// Workers — сколько доставок выполняется одновременно
+	Workers int
+	// AllowPrivate — внутренние сети через запятую (CIDR или адреса), куда
+	// разрешено доставлять вебхуки (WEBHOOK_ALLOW_PRIVATE). По умолчанию
+	// доставка возможна только на публичные адреса.
+	AllowPrivate string
+}
+
+// WebhookRequest — регистрация вебхука. Пустые фильтры пропускают все события.
+type WebhookRequest struct {
+	URL             string   `json:"url"`
+	Events          []string `json:"events"`
+	CustomerID      string   `json:"customer_id"`
+	DeliveryService string   `json:"delivery_service"`
+	// Secret — ключ подписи; если не задан, генерируется
+	Secret string `json:"secret"`
+}
+
+// Webhook — зарегистрированный получатель событий. Secret возвращается только
+// при регистрации.
+type Webhook struct {
+	ID              int64     `json:"id"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	CustomerID      string    `json:"customer_id,omitempty"`
+	DeliveryService string    `json:"delivery_service,omitempty"`
+	Secret          string    `json:"secret,omitempty"`
+	CreatedBy       string    `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// WebhookDelivery — доставка одного события на вебхук вместе с журналом попыток
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int64            `json:"webhook_id"`
+	EventID        string           `json:"event_id"`
+	Event          string           `json:"event"`
+	OrderUID       string           `json:"order_uid"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"`
+	LastStatusCode int              `json:"last_status_code,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at,omitempty"`
+	AttemptLog     []WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookAttempt — одна попытка доставки
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+}
+
+// WebhookDeliveryList — страница журнала доставок, новые первыми
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+}
+
+// webhookPayload — тело запроса к получателю
+type webhookPayload struct {
+	ID    string    `json:"id"`
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Order *Order    `json:"order"`
+}
+
+// webhookJob — доставка, взятая в работу
+type webhookJob struct {
+	ID       int64
+	EventID  string
+	Event    string
+	Payload  []byte
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// SignWebhook подписывает тело запроса: HMAC-SHA256 от "<timestamp>.<body>"
+// в формате заголовка X-Webhook-Signature "t=<timestamp>,v1=<hex>". Метка
+// времени входит в подпись, чтобы получатель мог отклонять старые запросы.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validate проверяет запрос на регистрацию и генерирует ключ подписи. Адрес
+// получателя, заданный IP-адресом, должен быть разрешен targets.
+func (req *WebhookRequest) validate(targets webhookTargets) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url должен быть абсолютным адресом http или https", ErrInvalidWebhook)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !targets.allowed(addr) {
+		return fmt.Errorf("%w: адрес %s недоступен для вебхуков", ErrInvalidWebhook, addr)
+	}
+	for _, event := range req.Events {
+		if event != model.EventOrderCreated && event != model.EventOrderUpdated {
+			return fmt.Errorf("%w: неизвестное событие %q, ожидается %s или %s",
+				ErrInvalidWebhook, event, model.EventOrderCreated, model.EventOrderUpdated)
+		}
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		rand.Read(b)
+		req.Secret = hex.EncodeToString(b)
+	} else if len(req.Secret) < 16 {
+		return fmt.Errorf("%w: secret короче 16 символов", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+// publicAddr сообщает, можно ли доставлять вебхуки на адрес: запрещены
+// loopback, частные сети (10/8, 172.16/12, 192.168/16, fc00::/7), link-local
+// (169.254/16 с метаданными облаков, fe80::/10), multicast и 0.0.0.0/::
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// webhookTargets — внутренние сети, куда разрешено доставлять вебхуки
+// помимо публичных адресов
+type webhookTargets []netip.Prefix
+
+// allowed сообщает, можно ли доставлять вебхуки на адрес
+func (t webhookTargets) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if publicAddr(addr) {
+		return true
+	}
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// control — Control для net.Dialer клиента вебхуков. Адрес проверяется после
+// разрешения имени, непосредственно перед подключением, поэтому обойти запрет
+// через DNS-имя, указывающее на внутренний адрес, или перенаправление нельзя.
+func (t webhookTargets) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес получателя %q: %w", address, err)
+	}
+	if !t.allowed(addrPort.Addr()) {
+		return fmt.Errorf("адрес %s недоступен для вебхуков", addrPort.Addr())
+	}
+	return nil
+}
+
+// CreateWebhook регистрирует вебхук. Запрос должен быть проверен
+// (WebhookRequest.validate), как это делает WebhookDispatcher.Create.
+func (db *DB) CreateWebhook(ctx context.Context, req WebhookRequest, createdBy string) (*Webhook, error) {
+	hook := &Webhook{
+		URL:             req.URL,
+		Events:          req.Events,
+		CustomerID:      req.CustomerID,
+		DeliveryService: req.DeliveryService,
+		Secret:          req.Secret,
+		CreatedBy:       createdBy,
+	}
+	err := db.pool.QueryRow(ctx, `
+		INSERT INTO webhooks (url, secret, events, customer_id, delivery_service, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		hook.URL, hook.Secret, hook.Events, hook.CustomerID, hook.DeliveryService, hook.CreatedBy,
+	).Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка регистрации вебхука: %w", err)
+	}
+	return hook, nil
+}
+
+// ListWebhooks возвращает зарегистрированные вебхуки без ключей подписи
+func (db *DB) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT id, url, events, customer_id, delivery_service, created_by, created_at
+		FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения вебхуков: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Events, &hook.CustomerID,
+			&hook.DeliveryService, &hook.CreatedBy, &hook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения вебхука: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом его доставок
+func (db *DB) DeleteWebhook(ctx context.Context, id int64) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления вебхука: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// enqueueWebhookEvent в транзакции сохранения заказа ставит событие о нем в
+// очередь доставки всем вебхукам, чьи фильтры ему соответствуют
+func (db *DB) enqueueWebhookEvent(ctx context.Context, tx pgx.Tx, order *Order, created bool) error {
+	event := model.EventOrderUpdated
+	if created {
+		event = model.EventOrderCreated
+	}
+	masked := order
+	if db.webhookRedactor != nil {
+		masked = db.webhookRedactor.Redact(order)
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	eventID := hex.EncodeToString(b)
+
+	payload, err := json.Marshal(webhookPayload{ID: eventID, Type: event, At: order.UpdatedAt.UTC(), Order: masked})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации события вебхука: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, order_uid, payload)
+		SELECT id, $1::text, $2::text, $3::text, $4::bytea FROM webhooks
+		WHERE (cardinality(events) = 0 OR $2 = ANY(events))
+			AND (customer_id = '' OR customer_id = $5)
+			AND (delivery_service = '' OR delivery_service = $6)`,
+		eventID, event, order.OrderUID, payload, order.CustomerID, order.DeliveryService)
+	if err != nil {
+		return fmt.Errorf("ошибка постановки события в очередь вебхуков: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries берет в работу до limit доставок, время которых
+// наступило. На время попытки следующий повтор отодвигается на lease, поэтому
+// другие экземпляры сервиса эти доставки не возьмут, а если экземпляр упадет
+// посреди попытки, доставка повторится после lease.
+func (db *DB) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhookJob, error) {
+	rows, err := db.pool.Query(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + $2::interval
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.event_id, d.event, d.payload, d.attempts, w.url, w.secret`,
+		limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выбора доставок вебхуков: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []webhookJob
+	for rows.Next() {
+		var job webhookJob
+		if err := rows.Scan(&job.ID, &job.EventID, &job.Event, &job.Payload, &job.Attempts, &job.URL, &job.Secret); err != nil {
+			return nil, fmt.Errorf("ошибка чтения доставки вебхука: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RecordWebhookAttempt записывает попытку в журнал и переводит доставку в
+// состояние status; next — время следующей попытки для pending
+func (db *DB) RecordWebhookAttempt(ctx context.Context, deliveryID int64, attempt WebhookAttempt, status string, next time.Time) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5)`,
+		deliveryID, attempt.AttemptedAt, attempt.StatusCode, attempt.Error, attempt.DurationMS); err != nil {
+		return fmt.Errorf("ошибка записи попытки доставки: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE webhook_deliveries SET
+			status = $2, attempts = attempts + 1, next_attempt_at = $3,
+			last_status_code = $4, last_error = $5,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN $6::timestamptz END
+		WHERE id = $1`,
+		deliveryID, status, next, attempt.StatusCode, attempt.Error, attempt.AttemptedAt); err != nil {
+		return fmt.Errorf("ошибка обновления доставки: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// WebhookDeliveries возвращает страницу журнала доставок вебхука, новые
+// первыми; status фильтрует по состоянию (пусто — все)
+func (db *DB) WebhookDeliveries(ctx context.Context, webhookID int64, status string, limit, offset int) (*WebhookDeliveryList, error) {
+	var exists bool
+	if err := db.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = $1)`, webhookID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ошибка поиска вебхука: %w", err)
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	list := &WebhookDeliveryList{Deliveries: []WebhookDelivery{}, Limit: limit, Offset: offset}
+	if err := db.pool.QueryRow(ctx, `
+		SELECT count(*) FROM webhook_deliveries WHERE webhook_id = $1 AND ($2 = '' OR status = $2)`,
+		webhookID, status).Scan(&list.Total); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета доставок: %w", err)
+	}
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT id, webhook_id, event_id, event, order_uid, status, attempts, next_attempt_at,
+			last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`,
+		webhookID, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения доставок: %w", err)
+	}
+	index := make(map[int64]int)
+	var ids []int64
+	for rows.Next() {
+		var d WebhookDelivery
+		var next time.Time
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.OrderUID, &d.Status, &d.Attempts,
+			&next, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения доставки: %w", err)
+		}
+		if d.Status == WebhookPending {
+			d.NextAttemptAt = &next
+		}
+		d.AttemptLog = []WebhookAttempt{}
+		index[d.ID] = len(list.Deliveries)
+		ids = append(ids, d.ID)
+		list.Deliveries = append(list.Deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения доставок: %w", err)
+	}
+	if len(ids) == 0 {
+		return list, nil
+	}
+
+	rows, err = db.pool.Query(ctx, `
+		SELECT delivery_id, attempted_at, status_code, error, duration_ms
+		FROM webhook_attempts WHERE delivery_id = ANY($1) ORDER BY id`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения попыток доставки: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var a WebhookAttempt
+		if err := rows.Scan(&id, &a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMS); err != nil {
+			return nil, fmt.Errorf("ошибка чтения попытки доставки: %w", err)
+		}
+		d := &list.Deliveries[index[id]]
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return list, rows.Err()
+}
+
+// RetryWebhookDelivery возвращает доставку в очередь с немедленной попыткой;
+// счетчик попыток сбрасывается
+func (db *DB) RetryWebhookDelivery(ctx context.Context, webhookID, deliveryID int64) error {
+	tag, err := db.pool.Exec(ctx, `
+		UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND webhook_id = $2 AND status <> 'pending'`, deliveryID, webhookID)
+	if err != nil {
+		return fmt.Errorf("ошибка повтора доставки: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		var status string
+		err := db.pool.QueryRow(ctx, `SELECT status FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2`,
+			deliveryID, webhookID).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: доставка %d не найдена", ErrWebhookNotFound, deliveryID)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка поиска доставки: %w", err)
+		}
+		// Доставка уже в очереди
+	}
+	return nil
+}
+
+// WebhookDispatcher доставляет события о заказах из очереди получателям с
+// повторами. Очередь хранится в БД и пополняется при сохранении заказов,
+// поэтому доставки переживают перезапуск, а несколько экземпляров сервиса
+// делят ее между собой.
+type WebhookDispatcher struct {
+	db      *DB
+	cfg     WebhookConfig
+	targets webhookTargets
+	client  *http.Client
+	wake    chan struct{}
+}
+
+// NewWebhookDispatcher создает диспетчер вебхуков. Клиент подключается только
+// к публичным адресам и сетям из cfg.AllowPrivate (webhookTargets.control).
+func NewWebhookDispatcher(db *DB, cfg WebhookConfig) (*WebhookDispatcher, error) {
+	targets, err := ParseNetworks(cfg.AllowPrivate)
+	if err != nil {
+		return nil, fmt.Errorf("WEBHOOK_ALLOW_PRIVATE: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Через прокси проверялся бы адрес прокси, а не получателя
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookTargets(targets).control,
+	}).DialContext
+	return &WebhookDispatcher{
+		db:      db,
+		cfg:     cfg,
+		targets: targets,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Перенаправление считается неудачной попыткой: адрес нужно исправить
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}, nil
+}
+
+// Wake будит доставку, не дожидаясь очередного опроса очереди. События
+// ставит в очередь DB.SaveOrder (SetWebhooks), поэтому пропущенный вызов
+// лишь откладывает доставку до следующего опроса.
+func (d *WebhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run доставляет события из очереди до отмены ctx
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue выполняет все доставки, время которых наступило
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) {
+	lease := d.cfg.Timeout + 30*time.Second
+	for ctx.Err() == nil {
+		jobs, err := d.db.ClaimWebhookDeliveries(ctx, d.cfg.Workers, lease)
+		if err != nil {
+			log.Printf("Ошибка выбора доставок вебхуков: %v", err)
+			return
+		}
+		if len(jobs) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.attempt(ctx, job)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// attempt выполняет одну попытку доставки и записывает ее результат
+func (d *WebhookDispatcher) attempt(ctx context.Context, job webhookJob) {
+	result := d.send(ctx, job)
+
+	status, next := d.outcome(job, result)
+	if status == WebhookFailed {
+		log.Printf("Доставка %d на %s не удалась после %d попыток: %s", job.ID, job.URL, job.Attempts+1, result.Error)
+	}
+	metrics.Inc("webhook_deliveries_total", "result", status)
+
+	if err := d.db.RecordWebhookAttempt(context.WithoutCancel(ctx), job.ID, result, status, next); err != nil {
+		log.Printf("Ошибка записи попытки доставки %d: %v", job.ID, err)
+	}
+}
+
+// outcome определяет по результату попытки новое состояние доставки и время
+// следующей попытки: неудача до MaxAttempts оставляет доставку в очереди с
+// паузой webhookBackoff
+func (d *WebhookDispatcher) outcome(job webhookJob, result WebhookAttempt) (string, time.Time) {
+	switch {
+	case result.Error == "":
+		return WebhookDelivered, result.AttemptedAt
+	case job.Attempts+1 >= d.cfg.MaxAttempts:
+		return WebhookFailed, result.AttemptedAt
+	default:
+		return WebhookPending, result.AttemptedAt.Add(webhookBackoff(job.Attempts + 1))
+	}
+}
+
+// send отправляет подписанное событие получателю. Успех — ответ 2xx;
+// иначе в Error попадает причина неудачи. Тело ответа не сохраняется: журнал
+// доставок не должен показывать содержимое чужих ответов.
+func (d *WebhookDispatcher) send(ctx context.Context, job webhookJob) WebhookAttempt {
+	result := WebhookAttempt{AttemptedAt: time.Now().UTC()}
+	defer func() {
+		result.DurationMS = time.Since(result.AttemptedAt).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "orders-service-webhooks")
+	req.Header.Set("X-Webhook-ID", job.EventID)
+	req.Header.Set("X-Webhook-Event", job.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(job.ID, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhook(job.Secret, result.AttemptedAt.Unix(), job.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = "HTTP " + strconv.Itoa(resp.StatusCode)
+	}
+	return result
+}
+
+// webhookBackoff возвращает паузу перед попыткой номер attempt+1
+func webhookBackoff(attempt int) time.Duration {
+	if attempt > 20 {
+		return webhookMaxBackoff
+	}
+	return min(webhookBaseBackoff<<(attempt-1), webhookMaxBackoff)
+}
+
+// Create регистрирует вебхук
+func (d *WebhookDispatcher) Create(ctx context.Context, req WebhookRequest, createdBy string) (*Webhook, error) {
+	if err := req.validate(d.targets); err != nil {
+		return nil, err
+	}
+	return d.db.CreateWebhook(ctx, req, createdBy)
+}
+
+// List возвращает зарегистрированные вебхуки
+func (d *WebhookDispatcher) List(ctx context.Context) ([]Webhook, error) {
+	return d.db.ListWebhooks(ctx)
+}
+
+// Delete удаляет вебхук
+func (d *WebhookDispatcher) Delete(ctx context.Context, id int64) error {
+	return d.db.DeleteWebhook(ctx, id)
+}
+
+// Deliveries возвращает журнал доставок вебхука
+func (d *WebhookDispatcher) Deliveries(ctx context.Context, webhookID int64, status string, limit, offset int) (*WebhookDeliveryList, error) {
+	if status != "" && !slices.Contains([]string{WebhookPending, WebhookDelivered, WebhookFailed}, status) {
+		return nil, fmt.Errorf("%w: status должен быть pending, delivered или failed", ErrInvalidWebhook)
+	}
+	return d.db.WebhookDeliveries(ctx, webhookID, status, limit, offset)
+}
+
+// Retry возвращает доставку в очередь и будит доставку
+func (d *WebhookDispatcher) Retry(ctx context.Context, webhookID, deliveryID int64) error {
+	if err := d.db.RetryWebhookDelivery(ctx, webhookID, deliveryID); err != nil {
+		return err
+	}
+	d.Wake()
+	return nil
+}
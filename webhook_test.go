@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"orders-service/client"
+	"orders-service/model"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+// newTestDispatcher создает диспетчер без БД, который доставляет на ts.
+// Клиент httptest подключается к 127.0.0.1, поэтому запрет внутренних адресов
+// в нем не действует.
+func newTestDispatcher(ts *httptest.Server, maxAttempts int) *WebhookDispatcher {
+	d, _ := NewWebhookDispatcher(nil, WebhookConfig{MaxAttempts: maxAttempts, Timeout: 5 * time.Second, Workers: 1})
+	d.client = ts.Client()
+	return d
+}
+
+// testWebhookJob создает доставку события о тестовом заказе на url
+func testWebhookJob(t *testing.T, url string, attempts int) webhookJob {
+	t.Helper()
+	payload, err := json.Marshal(webhookPayload{
+		ID: "event-1", Type: model.EventOrderCreated, At: time.Now().UTC(), Order: testOrder(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhookJob{
+		ID: 7, EventID: "event-1", Event: model.EventOrderCreated, Payload: payload,
+		Attempts: attempts, URL: url, Secret: testWebhookSecret,
+	}
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	order := testOrder(t)
+	received := make(chan *client.WebhookEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		event, err := client.VerifyWebhook(testWebhookSecret, r.Header.Get("X-Webhook-Signature"), body, time.Minute)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Webhook-ID") != event.ID || r.Header.Get("X-Webhook-Event") != event.Type {
+			t.Errorf("заголовки не совпадают с событием: %v", r.Header)
+		}
+		received <- event
+	}))
+	defer ts.Close()
+
+	d := newTestDispatcher(ts, 3)
+	job := testWebhookJob(t, ts.URL, 0)
+	result := d.send(context.Background(), job)
+	if result.Error != "" || result.StatusCode != http.StatusOK {
+		t.Fatalf("доставка не удалась: %+v", result)
+	}
+	if status, _ := d.outcome(job, result); status != WebhookDelivered {
+		t.Errorf("состояние %s, ожидалось %s", status, WebhookDelivered)
+	}
+
+	event := <-received
+	if event.ID != "event-1" || event.Type != model.EventOrderCreated || event.Order.OrderUID != order.OrderUID {
+		t.Errorf("получено другое событие: %+v", event)
+	}
+
+	// Подпись другим ключом получатель отклоняет
+	job.Secret = "another-webhook-secret"
+	if result := d.send(context.Background(), job); result.StatusCode != http.StatusUnauthorized {
+		t.Errorf("подпись чужим ключом: статус %d", result.StatusCode)
+	}
+}
+
+func TestWebhookRetriesAndFails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "внутренние подробности получателя", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	d := newTestDispatcher(ts, 3)
+
+	for attempts, wantBackoff := range []time.Duration{webhookBaseBackoff, 2 * webhookBaseBackoff} {
+		job := testWebhookJob(t, ts.URL, attempts)
+		result := d.send(context.Background(), job)
+		if result.StatusCode != http.StatusInternalServerError || result.Error != "HTTP 500" {
+			t.Fatalf("попытка %d: %+v", attempts+1, result)
+		}
+		status, next := d.outcome(job, result)
+		if status != WebhookPending || next.Sub(result.AttemptedAt) != wantBackoff {
+			t.Errorf("попытка %d: состояние %s, повтор через %v, ожидалось %s через %v",
+				attempts+1, status, next.Sub(result.AttemptedAt), WebhookPending, wantBackoff)
+		}
+	}
+
+	// Последняя разрешенная попытка переводит доставку в failed
+	job := testWebhookJob(t, ts.URL, 2)
+	if status, _ := d.outcome(job, d.send(context.Background(), job)); status != WebhookFailed {
+		t.Errorf("после MaxAttempts состояние %s, ожидалось %s", status, WebhookFailed)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		9:  2560 * time.Second,
+		10: webhookMaxBackoff,
+		50: webhookMaxBackoff,
+	} {
+		if got := webhookBackoff(attempt); got != want {
+			t.Errorf("webhookBackoff(%d) = %v, ожидалось %v", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookPrivateTargets(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer ts.Close()
+
+	// Клиент диспетчера по умолчанию не подключается к 127.0.0.1 — ни по
+	// адресу, ни по имени, которое в него разрешается
+	d, err := NewWebhookDispatcher(nil, WebhookConfig{MaxAttempts: 3, Timeout: 5 * time.Second, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	for _, url := range []string{ts.URL, byName} {
+		result := d.send(context.Background(), testWebhookJob(t, url, 0))
+		if !strings.Contains(result.Error, "недоступен для вебхуков") || calls.Load() != 0 {
+			t.Errorf("%s: доставка на loopback не отклонена: %+v, запросов %d", url, result, calls.Load())
+		}
+	}
+
+	// Внутренняя сеть из WEBHOOK_ALLOW_PRIVATE доступна тому же настоящему клиенту
+	allowed, err := NewWebhookDispatcher(nil, WebhookConfig{MaxAttempts: 3, Timeout: 5 * time.Second, Workers: 1, AllowPrivate: "127.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := allowed.send(context.Background(), testWebhookJob(t, ts.URL, 0)); result.StatusCode != http.StatusOK || calls.Load() != 1 {
+		t.Errorf("доставка в разрешенную сеть: %+v, запросов %d", result, calls.Load())
+	}
+	if _, err := NewWebhookDispatcher(nil, WebhookConfig{AllowPrivate: "10.0.0.0/33"}); err == nil {
+		t.Error("некорректная сеть в WEBHOOK_ALLOW_PRIVATE принята")
+	}
+
+	allowPrivate, err := ParseNetworks("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		url     string
+		targets webhookTargets
+		ok      bool
+	}{
+		{"https://partner.example/orders", nil, true},
+		{"http://8.8.8.8/hook", nil, true},
+		{"http://127.0.0.1:8080/hook", nil, false},
+		{"http://10.1.2.3/hook", nil, false},
+		{"http://192.168.0.10/hook", nil, false},
+		{"http://169.254.169.254/latest/meta-data", nil, false},
+		{"http://[::1]/hook", nil, false},
+		{"http://[fd00::1]/hook", nil, false},
+		{"http://[::ffff:127.0.0.1]/hook", nil, false},
+		{"http://0.0.0.0/hook", nil, false},
+		{"http://10.1.2.3/hook", allowPrivate, true},
+		{"http://192.168.0.10/hook", allowPrivate, false},
+	} {
+		req := WebhookRequest{URL: tc.url}
+		err := req.validate(tc.targets)
+		if (err == nil) != tc.ok || (err != nil && !errors.Is(err, ErrInvalidWebhook)) {
+			t.Errorf("%s: err=%v", tc.url, err)
+		}
+	}
+
+	if publicAddr(netip.MustParseAddr("172.16.0.1")) || !publicAddr(netip.MustParseAddr("172.32.0.1")) {
+		t.Error("граница частной сети 172.16/12 определена неверно")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsMaxSubscriptions — сколько заказов можно отслеживать в одном соединении
+	wsMaxSubscriptions = 100
+	// wsMaxMessageSize — максимальный размер сообщения от клиента
+	wsMaxMessageSize = 4 << 10
+	// wsPingInterval — интервал ping; клиент, не ответивший pong за wsPongWait,
+	// отключается
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	// wsWriteWait — время на отправку одного сообщения клиенту
+	wsWriteWait = 10 * time.Second
+)
+
+func init() {
+	metrics.Describe("orders_ws_rejected_total", "WebSocket-подключения, отклоненные лимитом соединений")
+}
+
+// WSLimits — ограничения WebSocket-подключений. Нулевой лимит отключает
+// соответствующую проверку.
+type WSLimits struct {
+	// MaxConnections — всего соединений на экземпляр сервиса
+	MaxConnections int
+	// MaxPerClient — соединений одного клиента (учетной записи или IP-адреса)
+	MaxPerClient int
+	// AllowedOrigins — разрешенные Origin через запятую; "*" — любой.
+	// Пусто — только тот же хост, что и у сервиса.
+	AllowedOrigins string
+}
+
+// defaultWSLimits — ограничения по умолчанию: и для сервера, созданного
+// NewServer, и для WS_MAX_CONNECTIONS и WS_MAX_CONNECTIONS_PER_CLIENT
+var defaultWSLimits = WSLimits{MaxConnections: 1000, MaxPerClient: 5}
+
+// wsConnLimiter считает открытые WebSocket-соединения
+type wsConnLimiter struct {
+	mu        sync.Mutex
+	limits    WSLimits
+	total     int
+	perClient map[string]int
+}
+
+func newWSConnLimiter(limits WSLimits) *wsConnLimiter {
+	return &wsConnLimiter{limits: limits, perClient: make(map[string]int)}
+}
+
+// acquire занимает место под соединение клиента key; пустая строка — успех,
+// иначе причина отказа
+func (l *wsConnLimiter) acquire(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.MaxConnections > 0 && l.total >= l.limits.MaxConnections {
+		return "достигнут лимит WebSocket-соединений сервиса"
+	}
+	if l.limits.MaxPerClient > 0 && l.perClient[key] >= l.limits.MaxPerClient {
+		return "достигнут лимит WebSocket-соединений клиента"
+	}
+	l.total++
+	l.perClient[key]++
+	return ""
+}
+
+func (l *wsConnLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perClient[key]--; l.perClient[key] <= 0 {
+		delete(l.perClient, key)
+	}
+}
+
+// newUpgrader создает Upgrader с проверкой Origin по списку allowed
+func newUpgrader(allowed string) websocket.Upgrader {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+	if allowed == "" {
+		// Проверка gorilla/websocket по умолчанию: Origin совпадает с Host
+		return upgrader
+	}
+	var origins []string
+	for _, origin := range strings.Split(allowed, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+		}
+	}
+	upgrader.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		// Клиенты вне браузера Origin не передают
+		return origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, strings.ToLower(origin))
+	}
+	return upgrader
+}
+
+// wsRequest — сообщение клиента: action = subscribe или unsubscribe
+type wsRequest struct {
+	Action    string   `json:"action"`
+	OrderUIDs []string `json:"order_uids"`
+}
+
+// wsMessage — сообщение сервера. type: subscriptions — текущий список
+// отслеживаемых заказов; snapshot — состояние заказа на момент подписки;
+// order.created и order.updated — новая версия заказа; error — ошибка в
+// запросе клиента.
+type wsMessage struct {
+	Type      string    `json:"type"`
+	OrderUIDs []string  `json:"order_uids,omitzero"`
+	At        time.Time `json:"at,omitzero"`
+	Order     *Order    `json:"order,omitempty"`
+	// Changed — поля заказа верхнего уровня, изменившиеся с предыдущей
+	// отправленной версии
+	Changed []string `json:"changed,omitempty"`
+	Code    string   `json:"code,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+}
+
+// wsWatch — подписки одного соединения и последние отправленные версии заказов
+type wsWatch struct {
+	uids map[string]struct{}
+	last map[string]map[string]json.RawMessage
+}
+
+// handleWatch принимает WebSocket-подключения для отслеживания отдельных
+// заказов. Клиент отправляет {"action":"subscribe","order_uids":[...]} (или
+// unsubscribe) и получает текущее состояние заказов, а затем каждую новую
+// версию вместе со списком изменившихся полей. Начальные подписки можно
+// передать параметром order_uid через запятую.
+func (s *Server) handleWatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.hub == nil {
+			writeProblem(w, r, http.StatusServiceUnavailable, CodeUnavailable, "поток событий не настроен")
+			return
+		}
+		if !websocket.IsWebSocketUpgrade(r) {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidRequest, "ожидается WebSocket-подключение")
+			return
+		}
+
+		key := s.clientKey(r)
+		if reason := s.wsConns.acquire(key); reason != "" {
+			metrics.Inc("orders_ws_rejected_total")
+			w.Header().Set("Retry-After", "10")
+			writeProblem(w, r, http.StatusTooManyRequests, CodeRateLimited, reason)
+			return
+		}
+		defer s.wsConns.release(key)
+
+		// При ошибке Upgrade сам отвечает клиенту
+		conn, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		sub, _, _ := s.hub.Subscribe(0)
+		defer s.hub.Unsubscribe(sub)
+
+		// Чтение идет в отдельной горутине; писать в соединение может только
+		// основной цикл
+		requests := make(chan wsRequest)
+		closed, done := make(chan struct{}), make(chan struct{})
+		defer close(done)
+		go func() {
+			defer close(closed)
+			conn.SetReadLimit(wsMaxMessageSize)
+			conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			})
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				var req wsRequest
+				if err := json.Unmarshal(data, &req); err != nil {
+					req = wsRequest{}
+				}
+				select {
+				case requests <- req:
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		watch := &wsWatch{uids: make(map[string]struct{}), last: make(map[string]map[string]json.RawMessage)}
+		send := func(msg wsMessage) error {
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			return conn.WriteJSON(msg)
+		}
+
+		if initial := r.URL.Query().Get("order_uid"); initial != "" {
+			if err := s.wsHandle(r, watch, wsRequest{Action: "subscribe", OrderUIDs: strings.Split(initial, ",")}, send); err != nil {
+				return
+			}
+		}
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case <-sub.dropped:
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "клиент не успевает читать события"),
+					time.Now().Add(wsWriteWait))
+				return
+			case req := <-requests:
+				if err := s.wsHandle(r, watch, req, send); err != nil {
+					return
+				}
+			case ev := <-sub.events:
+				if _, ok := watch.uids[ev.Order.OrderUID]; !ok {
+					continue
+				}
+				if err := s.wsSendOrder(r, watch, ev.Type, ev.At, ev.Order, send); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// wsHandle выполняет запрос клиента на подписку или отписку
+func (s *Server) wsHandle(r *http.Request, watch *wsWatch, req wsRequest, send func(wsMessage) error) error {
+	switch req.Action {
+	case "subscribe":
+		var added []string
+		full := false
+		for _, uid := range req.OrderUIDs {
+			uid = strings.TrimSpace(uid)
+			if _, ok := watch.uids[uid]; ok || uid == "" {
+				continue
+			}
+			if len(watch.uids) >= wsMaxSubscriptions {
+				full = true
+				break
+			}
+			watch.uids[uid] = struct{}{}
+			added = append(added, uid)
+		}
+		if err := send(wsMessage{Type: "subscriptions", OrderUIDs: watch.list()}); err != nil {
+			return err
+		}
+		if full {
+			err := send(wsMessage{Type: "error", Code: CodeInvalidRequest,
+				Detail: fmt.Sprintf("в одном соединении можно отслеживать не больше %d заказов", wsMaxSubscriptions)})
+			if err != nil {
+				return err
+			}
+		}
+		for _, uid := range added {
+			entry, ok := s.cache.Lookup(uid)
+			if !ok {
+				continue
+			}
+			if err := s.wsSendOrder(r, watch, "snapshot", entry.Modified, entry.Order, send); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "unsubscribe":
+		for _, uid := range req.OrderUIDs {
+			delete(watch.uids, uid)
+			delete(watch.last, uid)
+		}
+		return send(wsMessage{Type: "subscriptions", OrderUIDs: watch.list()})
+	default:
+		return send(wsMessage{Type: "error", Code: CodeInvalidRequest,
+			Detail: `ожидается {"action":"subscribe"|"unsubscribe","order_uids":[...]}`})
+	}
+}
+
+// wsSendOrder отправляет версию заказа и запоминает ее для вычисления
+// изменившихся полей. Версия без изменений не отправляется.
+func (s *Server) wsSendOrder(r *http.Request, watch *wsWatch, typ string, at time.Time, order *Order, send func(wsMessage) error) error {
+	presented := s.present(r, order)
+	body, err := json.Marshal(presented)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+
+	msg := wsMessage{Type: typ, At: at, Order: presented}
+	if prev, ok := watch.last[order.OrderUID]; ok {
+		for name, value := range fields {
+			if !bytes.Equal(prev[name], value) {
+				msg.Changed = append(msg.Changed, name)
+			}
+		}
+		if len(msg.Changed) == 0 {
+			return nil
+		}
+		slices.Sort(msg.Changed)
+	}
+	watch.last[order.OrderUID] = fields
+	return send(msg)
+}
+
+// list возвращает отслеживаемые заказы в порядке сортировки
+func (w *wsWatch) list() []string {
+	uids := make([]string, 0, len(w.uids))
+	for uid := range w.uids {
+		uids = append(uids, uid)
+	}
+	slices.Sort(uids)
+	return uids
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Сервер с потоком событий, но без SetWebSocketLimits, принимает
+// подключения с ограничениями по умолчанию
+func TestWatchWithDefaultLimits(t *testing.T) {
+	cache := NewOrderCache()
+	order := testOrder(t)
+	cache.Set(order.OrderUID, order)
+	s := NewServer(cache, nil, nil)
+	s.SetHub(NewHub())
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/orders/watch?order_uid=" + order.OrderUID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("подключение: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for _, want := range []string{"subscriptions", "snapshot"} {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("чтение %s: %v", want, err)
+		}
+		if msg.Type != want {
+			t.Errorf("получено сообщение %q, ожидалось %q", msg.Type, want)
+		}
+	}
+}